@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/qawatake/gw/internal/branch"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+func runClean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only show what would be removed")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+	force := fs.Bool("force", false, "also remove worktrees with unsaved work")
+	staleDays := fs.Int("stale", 0, "also remove worktrees untouched for this many days (0 disables)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw clean [--dry-run] [--yes] [--force] [--stale days]")
+		fs.PrintDefaults()
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *staleDays < 0 {
+		return fmt.Errorf("--stale must not be negative")
+	}
+
+	worktrees, err := listSorted("activity")
+	if err != nil {
+		return err
+	}
+
+	defaultBranch, err := branch.GetDefaultBranch()
+	if err != nil {
+		return err
+	}
+
+	// The local default branch may lag behind the remote one, so check both
+	var targets []string
+	if branch.Exists(defaultBranch) {
+		targets = append(targets, defaultBranch)
+	}
+	if remote, err := branch.GetRemoteDefaultBranch(); err == nil {
+		targets = append(targets, remote)
+	}
+
+	// Unpushed commits are checked against a default branch that exists
+	defaultRef := branch.GetDefaultRef()
+
+	gone, err := branch.ListGone()
+	if err != nil {
+		return err
+	}
+
+	var staleBefore time.Time
+	if *staleDays > 0 {
+		staleBefore = time.Now().AddDate(0, 0, -*staleDays)
+	}
+
+	var removals []removal
+	for _, wt := range worktrees {
+		// Prunable worktrees are left to gw prune; detached ones have no branch
+		// that could have been merged and weren't created by gw add
+		if wt.IsMain || wt.IsBare || wt.Prunable || wt.Detached || wt.Branch == defaultBranch {
+			continue
+		}
+
+		var reasons []string
+		merged, err := mergedInto(wt, targets)
+		if err != nil {
+			return err
+		}
+		if merged != "" {
+			reasons = append(reasons, "merged into "+merged)
+		}
+		if gone[wt.Branch] {
+			reasons = append(reasons, "upstream is gone")
+		}
+		if last := worktree.LastActivity(wt); !staleBefore.IsZero() && last.Before(staleBefore) {
+			reasons = append(reasons, fmt.Sprintf("untouched for %d days", int(time.Since(last).Hours()/24)))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		if wt.Locked {
+			fmt.Fprintf(os.Stderr, "Skipped locked worktree %s (%s)\n", worktree.Label(wt), strings.Join(reasons, ", "))
+			continue
+		}
+
+		unsaved, err := worktree.FindUnsaved(wt, defaultRef)
+		if err != nil {
+			// A worktree that can't be checked may hold anything
+			if !*force {
+				fmt.Fprintf(os.Stderr, "Skipped %s (%s): failed to check for unsaved work: %v (use --force to remove it anyway)\n",
+					worktree.Label(wt), strings.Join(reasons, ", "), err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Warning: failed to check %s for unsaved work: %v\n", worktree.Label(wt), err)
+		}
+		// The commits of a squash-merged branch aren't in the default branch, but their changes are
+		if merged != "" {
+			unsaved.Commits = nil
+		}
+		if !unsaved.Empty() && !*force {
+			fmt.Fprintf(os.Stderr, "Skipped %s (%s): %s (use --force to remove it anyway)\n",
+				worktree.Label(wt), strings.Join(reasons, ", "), strings.Join(unsaved.Summary(defaultRef), ", "))
+			continue
+		}
+
+		removals = append(removals, removal{Worktree: wt, unsaved: unsaved, reason: strings.Join(reasons, ", ")})
+	}
+
+	if len(removals) == 0 {
+		if verbose {
+			fmt.Println("No worktrees to clean")
+		}
+		return nil
+	}
+
+	return removeWorktrees(removals, defaultRef, removeOptions{dryRun: *dryRun, yes: *yes, force: *force})
+}
+
+// mergedInto returns the first of targets that the worktree's changes were merged
+// into, or an empty string if there is none
+// Branches that never got a commit of their own are not considered merged, so
+// that newly added worktrees aren't cleaned.
+func mergedInto(wt worktree.Worktree, targets []string) (string, error) {
+	if wt.Commit == "" || branch.StartCommit(wt.Branch) == wt.Commit {
+		return "", nil
+	}
+	for _, target := range targets {
+		merged, err := branch.IsMerged(wt.Commit, target)
+		if err != nil {
+			return "", err
+		}
+		if merged {
+			return target, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/qawatake/gw/internal/state"
+	"github.com/qawatake/gw/internal/ui"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+// runVisit records a visit to the worktree containing the current directory
+// The shell wrapper calls it whenever the directory changes, so that cds done
+// outside gw are part of the navigation history. It never fails loudly.
+func runVisit(args []string) error {
+	current, err := worktree.CurrentPath()
+	if err != nil {
+		// Not in a repository
+		return nil
+	}
+
+	// Only repositories that gw manages have a worktree root
+	rootDir, _, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(rootDir); err != nil {
+		return nil
+	}
+
+	if err := state.Update(rootDir, func(s *state.Store) { s.RecordVisit(current) }); err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
+
+// visitedWorktrees returns the worktrees in the navigation history, most recently visited first
+func visitedWorktrees(worktrees []worktree.Worktree, rootDir string) []worktree.Worktree {
+	st, err := state.Load(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	byPath := make(map[string]worktree.Worktree, len(worktrees))
+	for _, wt := range worktrees {
+		byPath[wt.Path] = wt
+	}
+
+	var visited []worktree.Worktree
+	for _, path := range st.Recent() {
+		if wt, ok := byPath[path]; ok {
+			visited = append(visited, wt)
+		}
+	}
+	return visited
+}
+
+// previousWorktree returns the most recently visited worktree other than the current one
+func previousWorktree(worktrees []worktree.Worktree, rootDir string) (*worktree.Worktree, error) {
+	current, _ := worktree.CurrentPath()
+	for _, wt := range visitedWorktrees(worktrees, rootDir) {
+		if wt.Path != current {
+			return &wt, nil
+		}
+	}
+	return nil, fmt.Errorf("no previous worktree")
+}
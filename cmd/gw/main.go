@@ -1,15 +1,26 @@
 package main
 
 import (
+	"cmp"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/qawatake/gw/internal/branch"
+	"github.com/qawatake/gw/internal/directive"
+	"github.com/qawatake/gw/internal/hook"
 	"github.com/qawatake/gw/internal/link"
 	"github.com/qawatake/gw/internal/shell"
+	"github.com/qawatake/gw/internal/state"
+	"github.com/qawatake/gw/internal/txn"
 	"github.com/qawatake/gw/internal/ui"
 	"github.com/qawatake/gw/internal/worktree"
 )
@@ -40,47 +51,67 @@ func main() {
 	command := args[0]
 	args = args[1:]
 
+	var err error
 	switch command {
 	case "init":
-		if err := runInit(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runInit(args)
 	case "add":
-		if err := runAdd(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runAdd(args)
 	case "list", "ls":
-		if err := runList(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runList(args)
 	case "cd":
-		if err := runCD(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runCD(args)
 	case "rm":
-		if err := runRM(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runRM(args)
 	case "pr":
-		if err := runPR(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runPR(args)
 	case "ln":
-		if err := runLn(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runLn(args)
+	case "note":
+		err = runNote(args)
+	case "prune":
+		err = runPrune(args)
+	case "clean":
+		err = runClean(args)
+	case "__visit":
+		err = runVisit(args)
+	case "__preview":
+		err = runPreview(args)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		printUsage()
 		os.Exit(1)
 	}
+
+	if err != nil {
+		// Usage has already been printed by the flag package
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses flags that may appear before or after positional arguments
+// and returns the positional arguments. Arguments after "--" are never parsed as flags.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// fs.Parse stops after "--", so everything left is positional
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
 }
 
 func printUsage() {
@@ -88,11 +119,14 @@ func printUsage() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  gw init               Initialize shell wrapper")
-	fmt.Println("  gw add                Create a new branch and worktree")
-	fmt.Println("  gw list (ls)          List all worktrees")
-	fmt.Println("  gw cd                 Change directory to a worktree")
-	fmt.Println("  gw rm                 Remove selected worktrees")
+	fmt.Println("  gw add [name]         Create a new branch and worktree")
+	fmt.Println("  gw list (ls)          List all worktrees (--json, --format, --porcelain)")
+	fmt.Println("  gw cd [query | -]     Change directory to a worktree (--history)")
+	fmt.Println("  gw rm [query...]      Remove selected worktrees (--locked, --current, --force)")
+	fmt.Println("  gw prune              Clean up worktrees whose directories were deleted")
+	fmt.Println("  gw clean              Remove merged, gone or stale worktrees (--stale, --dry-run, --yes)")
 	fmt.Println("  gw pr checkout        Checkout a PR branch into a new worktree")
+	fmt.Println("  gw note [query]       Edit the notes of the current or a selected worktree")
 	fmt.Println("  gw ln add <path>      Share a file/directory across worktrees")
 	fmt.Println("  gw ln ls              List shared files/directories")
 	fmt.Println("  gw ln pull            Pull missing shared files into current worktree")
@@ -109,21 +143,98 @@ func runInit(args []string) error {
 }
 
 func runAdd(args []string) error {
-	// Get branch name from user via editor
-	name, err := ui.EditWithEditor("")
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	noEdit := fs.Bool("no-edit", false, "do not open the editor; use the name argument or stdin as-is")
+	printPath := fs.Bool("print-path", false, "print the created worktree path to stdout")
+	baseFlag := fs.String("base", "", "ref to start the new branch from (default: $GW_BASE or the current HEAD)")
+	fetch := fs.Bool("fetch", false, "fetch the base ref from its remote before branching")
+	onConflict := fs.String("on-conflict", "", "what to do if the branch or path already exists: reuse, jump, suffix or abort (default: ask)")
+	cd := fs.Bool("cd", addCDEnabled(), "move the shell into the new worktree (default: $GW_ADD_CD)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw add [--no-edit] [--print-path] [--base <ref>] [--fetch] [--on-conflict <action>] [--cd] [name]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseFlags(fs, args)
 	if err != nil {
-		return fmt.Errorf("failed to get branch name: %w", err)
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("too many arguments: gw add [name]")
+	}
+	if *onConflict != "" && !slices.Contains(conflictActions, *onConflict) {
+		return fmt.Errorf("invalid --on-conflict %q (available: %s)", *onConflict, strings.Join(conflictActions, ", "))
 	}
 
-	if name == "" {
-		return fmt.Errorf("branch name cannot be empty")
+	// Validate configuration before asking for a name so mistakes fail fast
+	if _, err := worktree.GetPathTemplate(); err != nil {
+		return err
+	}
+	// Fetch before resolving so that a remote branch that isn't fetched yet can be the base
+	baseRef := cmp.Or(*baseFlag, os.Getenv("GW_BASE"))
+	if *fetch {
+		if baseRef == "" {
+			baseRef, err = branch.GetRemoteDefaultBranch()
+			if err != nil {
+				return err
+			}
+		}
+		if verbose {
+			fmt.Printf("Fetching %s...\n", baseRef)
+		}
+		if err := branch.FetchBase(baseRef); err != nil {
+			return err
+		}
+	}
+	base, err := branch.ResolveBase(baseRef)
+	if err != nil {
+		return err
+	}
+	// Without a base the branch starts from HEAD, which is recorded as its base
+	if base == "" {
+		base, err = branch.CurrentRef()
+		if err != nil {
+			return err
+		}
 	}
 
-	// Generate full branch name with prefix
-	branchName, err := branch.GenerateBranchName(name)
+	name, description, edited, err := readAddName(positional, *noEdit)
 	if err != nil {
 		return err
 	}
+
+	var branchName string
+	for {
+		name = branch.NormalizeName(name)
+		if name == "" {
+			return fmt.Errorf("branch name cannot be empty")
+		}
+
+		// Generate full branch name with prefix
+		branchName, err = branch.GenerateBranchName(name)
+		if err != nil {
+			return err
+		}
+
+		verr := branch.ValidateName(branchName)
+		if verr == nil {
+			break
+		}
+		if !edited {
+			return fmt.Errorf("invalid branch name %q: %w", branchName, verr)
+		}
+
+		// Reopen the editor with the error shown as comments, like git commit does
+		message := fmt.Sprintf("Invalid branch name %q: %v\nFix the name on the first line, or empty it to abort.", branchName, verr)
+		buffer := name + "\n\n"
+		if description != "" {
+			buffer += description + "\n\n"
+		}
+		content, err := ui.EditWithEditor(buffer + ui.CommentLines(message))
+		if err != nil {
+			return fmt.Errorf("failed to get branch name: %w", err)
+		}
+		name, description = splitBuffer(content)
+	}
 	if verbose {
 		fmt.Printf("Creating branch: %s\n", branchName)
 	}
@@ -134,22 +245,91 @@ func runAdd(args []string) error {
 		return err
 	}
 
-	// Generate worktree path from user input (not branch name)
-	wtPath := worktree.GenerateWorktreePath(name, rootDir, repoName)
+	// Generate worktree path from user input (and branch name if the template uses it)
+	wtPath, err := worktree.GenerateWorktreePath(name, branchName, rootDir, repoName)
+	if err != nil {
+		return err
+	}
+
+	// Handle branch and path collisions before creating anything
+	reuseBranch := false
+	collision, err := detectCollision(branchName, wtPath)
+	if err != nil {
+		return err
+	}
+	if collision != nil {
+		action, err := chooseConflictAction(collision, *onConflict)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case "jump":
+			fmt.Fprintf(os.Stderr, "Worktree for %s already exists: %s\n", branchName, collision.Worktree.Path)
+			if *printPath {
+				fmt.Println(collision.Worktree.Path)
+			}
+			if *cd {
+				return enterNewWorktree(collision.Worktree.Path, branchName, rootDir, repoName)
+			}
+			return nil
+		case "reuse":
+			reuseBranch = true
+			if collision.PathExists {
+				_, wtPath, err = nextFreeName(name, rootDir, repoName, true)
+				if err != nil {
+					return err
+				}
+			}
+		case "suffix":
+			name, wtPath, err = nextFreeName(name, rootDir, repoName, false)
+			if err != nil {
+				return err
+			}
+			if branchName, err = branch.GenerateBranchName(name); err != nil {
+				return err
+			}
+		}
+	}
+
 	if verbose {
 		fmt.Printf("Creating worktree at: %s\n", wtPath)
 	}
 
-	// Create worktree
-	if err := worktree.Add(wtPath, branchName); err != nil {
+	hookEnv, err := newHookEnv(wtPath, branchName, rootDir, repoName)
+	if err != nil {
+		return err
+	}
+	if err := hook.Run(hook.PreAdd, hookEnv); err != nil {
 		return err
 	}
 
-	// Create symlinks for shared files
-	warnings := link.CreateSymlinks(wtPath, rootDir)
-	for _, w := range warnings {
-		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	target := &worktreeTarget{Path: wtPath, Branch: branchName, RootDir: rootDir}
+	steps := []txn.Step{containerStep(target)}
+	if !reuseBranch {
+		steps = append(steps, txn.Step{
+			Name: "create branch",
+			Do: func() error {
+				if err := branch.CreateFrom(branchName, base); err != nil {
+					return err
+				}
+				// Record the base so other commands can show commits since base
+				return branch.SetBase(branchName, base)
+			},
+			Undo: func() error {
+				return worktree.RemoveBranch(branchName)
+			},
+		})
+	}
+	if description != "" {
+		steps = append(steps, descriptionSteps(target, rootDir, repoName, description)...)
+	}
+	steps = append(steps, worktreeSteps(target)...)
+	steps = append(steps, postAddStep(target, repoName))
+
+	if err := txn.Run(steps); err != nil {
+		return err
 	}
+	updateState(rootDir, func(s *state.Store) { s.RecordCreated(wtPath) })
 
 	if verbose {
 		fmt.Printf("✓ Successfully created worktree\n")
@@ -157,93 +337,532 @@ func runAdd(args []string) error {
 		fmt.Printf("  Path: %s\n", wtPath)
 	}
 
+	if *printPath {
+		fmt.Println(wtPath)
+	}
+
+	if *cd {
+		return enterNewWorktree(wtPath, branchName, rootDir, repoName)
+	}
+
 	return nil
 }
 
+// addCDEnabled reports whether GW_ADD_CD asks gw add and gw pr checkout to move
+// the shell into the new worktree by default
+func addCDEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("GW_ADD_CD"))
+	return enabled
+}
+
+// enterNewWorktree moves the shell into a worktree gw has just created
+// Without the shell wrapper, printing a cd command would mix with the output, so
+// only a warning is shown.
+func enterNewWorktree(path, branchName, rootDir, repoName string) error {
+	if !directive.Available() {
+		fmt.Fprintln(os.Stderr, "Warning: can't move the shell without the shell integration (see gw init)")
+		return nil
+	}
+	return enterWorktree(path, path, branchName, rootDir, repoName)
+}
+
+// enterWorktree moves the shell to dir in the worktree at path through the shell wrapper
+// Like gw cd, it runs the post-cd hook and records the visit.
+func enterWorktree(path, dir, branchName, rootDir, repoName string) error {
+	// A failing post-cd hook doesn't prevent the cd
+	env, err := newHookEnv(path, branchName, rootDir, repoName)
+	if err != nil {
+		return err
+	}
+	if err := hook.Run(hook.PostCD, env); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	updateState(rootDir, func(s *state.Store) { s.RecordVisit(path) })
+
+	// Let the shell wrapper move the shell
+	return directive.CD(dir)
+}
+
+// descriptionSteps store the description from the editor buffer as
+// branch.<name>.description and in the notes file next to the worktree
+func descriptionSteps(target *worktreeTarget, rootDir, repoName, description string) []txn.Step {
+	var previous string
+	steps := []txn.Step{
+		{
+			Name: "set branch description",
+			Do: func() error {
+				// A reused branch may already have a description
+				previous = branch.GetDescription(target.Branch)
+				return branch.SetDescription(target.Branch, description)
+			},
+			Undo: func() error {
+				return branch.SetDescription(target.Branch, previous)
+			},
+		},
+	}
+
+	notesPath := worktree.NotesPath(target.Path, rootDir, repoName)
+	if notesPath == "" {
+		return steps
+	}
+	return append(steps, txn.Step{
+		Name: "write notes",
+		Do: func() error {
+			if _, err := os.Stat(notesPath); err == nil {
+				return fmt.Errorf("notes file already exists: %s", notesPath)
+			}
+			if err := os.WriteFile(notesPath, []byte(description+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write notes: %w", err)
+			}
+			return nil
+		},
+		Undo: func() error {
+			return os.Remove(notesPath)
+		},
+	})
+}
+
+// conflictActions are the ways gw add can resolve a branch or path collision
+var conflictActions = []string{"reuse", "jump", "suffix", "abort"}
+
+// addCollision describes what already exists for a new worktree
+type addCollision struct {
+	BranchExists bool
+	Worktree     *worktree.Worktree // worktree that has the branch checked out
+	PathExists   bool
+}
+
+// actions returns the conflict actions applicable to the collision
+func (c *addCollision) actions() []string {
+	var actions []string
+	if c.BranchExists && c.Worktree == nil {
+		actions = append(actions, "reuse")
+	}
+	if c.Worktree != nil {
+		actions = append(actions, "jump")
+	}
+	return append(actions, "suffix", "abort")
+}
+
+// detectCollision checks whether the branch or worktree path is already taken
+// It returns nil if neither exists.
+func detectCollision(branchName, wtPath string) (*addCollision, error) {
+	c := &addCollision{BranchExists: branch.Exists(branchName)}
+	if _, err := os.Stat(wtPath); err == nil {
+		c.PathExists = true
+	}
+
+	if c.BranchExists {
+		worktrees, err := worktree.List()
+		if err != nil {
+			return nil, err
+		}
+		for i := range worktrees {
+			if worktrees[i].Branch == branchName {
+				c.Worktree = &worktrees[i]
+				break
+			}
+		}
+	}
+
+	if !c.BranchExists && !c.PathExists {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// chooseConflictAction returns the action for a collision, asking the user unless
+// one was given with --on-conflict
+func chooseConflictAction(c *addCollision, action string) (string, error) {
+	var problems []string
+	if c.Worktree != nil {
+		problems = append(problems, fmt.Sprintf("branch is already checked out at %s", c.Worktree.Path))
+	} else if c.BranchExists {
+		problems = append(problems, "branch already exists")
+	}
+	if c.PathExists {
+		problems = append(problems, "worktree path already exists")
+	}
+	problem := strings.Join(problems, ", ")
+	actions := c.actions()
+
+	if action == "" {
+		if !ui.HasTTY() {
+			return "", fmt.Errorf("%s (use --on-conflict=%s)", problem, strings.Join(actions, "|"))
+		}
+		choices := make([]ui.Choice, len(actions))
+		for i, a := range actions {
+			choices[i] = ui.Choice{Key: a[:1], Label: a}
+		}
+		key, err := ui.Choose(strings.ToUpper(problem[:1])+problem[1:]+".", choices)
+		if err != nil {
+			return "", err
+		}
+		for _, a := range actions {
+			if a[:1] == key {
+				action = a
+			}
+		}
+	}
+
+	if !slices.Contains(actions, action) {
+		return "", fmt.Errorf("%s: cannot %s (available: %s)", problem, action, strings.Join(actions, ", "))
+	}
+	if action == "abort" {
+		return "", fmt.Errorf("%s", problem)
+	}
+	return action, nil
+}
+
+// nextFreeName finds the first "{name}-N" whose worktree path (and branch, unless
+// the existing branch is reused) is not taken yet
+func nextFreeName(name, rootDir, repoName string, reuseBranch bool) (string, string, error) {
+	for n := 2; n < 100; n++ {
+		candidate := fmt.Sprintf("%s-%d", name, n)
+		// Only the path needs a suffix if the existing branch is reused
+		branchName, err := branch.GenerateBranchName(candidate)
+		if reuseBranch {
+			branchName, err = branch.GenerateBranchName(name)
+		}
+		if err != nil {
+			return "", "", err
+		}
+		wtPath, err := worktree.GenerateWorktreePath(candidate, branchName, rootDir, repoName)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := os.Stat(wtPath); err == nil {
+			continue
+		}
+		if !reuseBranch && branch.Exists(branchName) {
+			continue
+		}
+		return candidate, wtPath, nil
+	}
+	return "", "", fmt.Errorf("no free name found for %q", name)
+}
+
+// readAddName determines the name and description for a new worktree and reports
+// whether they came from the editor
+// A name argument skips the editor. Otherwise piped stdin prefills the editor buffer,
+// and is used as-is when --no-edit is given or no terminal is available.
+func readAddName(positional []string, noEdit bool) (string, string, bool, error) {
+	if len(positional) == 1 {
+		return strings.TrimSpace(positional[0]), "", false, nil
+	}
+
+	input, err := ui.ReadStdin()
+	if err != nil {
+		return "", "", false, err
+	}
+
+	if noEdit || !ui.HasTTY() {
+		if input == "" {
+			return "", "", false, fmt.Errorf("branch name required: gw add <name> or pipe it via stdin")
+		}
+		name, description := splitBuffer(input)
+		return name, description, false, nil
+	}
+
+	// Get branch name from user via editor
+	content, err := ui.EditWithEditor(input)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get branch name: %w", err)
+	}
+	name, description := splitBuffer(content)
+	return name, description, true, nil
+}
+
+// splitBuffer splits an editor buffer into the name on the first line
+// and the description in the remaining lines
+func splitBuffer(content string) (string, string) {
+	name, description, _ := strings.Cut(content, "\n")
+	return strings.TrimSpace(name), strings.TrimSpace(description)
+}
+
 func runList(args []string) error {
-	worktrees, err := worktree.List()
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	jsonFlag := fs.Bool("json", false, "print worktrees as a JSON array")
+	format := fs.String("format", "", "print each worktree with a Go template (e.g. '{{.Branch}} {{.Path}}')")
+	porcelain := fs.Bool("porcelain", false, "print stable tab-separated lines: path, branch, commit, unix time, flags")
+	status := fs.Bool("status", statusEnabled(), "show changes, ahead/behind and last commit columns (default: $GW_LIST_STATUS)")
+	sortOrder := fs.String("sort", "activity", "sort order: "+strings.Join(worktree.SortOrders, ", "))
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw list [--status] [--sort <order>] [--json | --format <template> | --porcelain]")
+		fs.PrintDefaults()
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	modes := 0
+	for _, set := range []bool{*jsonFlag, *format != "", *porcelain} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("--json, --format and --porcelain are mutually exclusive")
+	}
+
+	var tmpl *template.Template
+	if *format != "" {
+		var err error
+		tmpl, err = template.New("format").Parse(*format)
+		if err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+	}
+
+	worktrees, err := listSorted(*sortOrder)
 	if err != nil {
 		return err
 	}
 
-	for _, wt := range worktrees {
-		fmt.Println(worktree.Format(wt))
+	// Table output loads the status itself to share the default branch lookup
+	if *status && (*jsonFlag || tmpl != nil) {
+		worktree.LoadStatus(worktrees, branch.GetDefaultRef())
+	}
+
+	switch {
+	case *jsonFlag:
+		if worktrees == nil {
+			worktrees = []worktree.Worktree{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(worktrees)
+	case tmpl != nil:
+		for _, wt := range worktrees {
+			if err := tmpl.Execute(os.Stdout, wt); err != nil {
+				return fmt.Errorf("failed to format worktree: %w", err)
+			}
+			fmt.Println()
+		}
+	case *porcelain:
+		for _, wt := range worktrees {
+			fmt.Println(worktree.FormatPorcelain(wt))
+		}
+	default:
+		for _, line := range formatWorktrees(worktrees, *status, ui.ColorEnabled()) {
+			fmt.Println(line)
+		}
 	}
 
 	return nil
 }
 
-func runCD(args []string) error {
-	// Get worktree list
+// listSorted lists worktrees with their recorded creation and visit times, in the given order
+func listSorted(order string) ([]worktree.Worktree, error) {
 	worktrees, err := worktree.List()
+	if err != nil {
+		return nil, err
+	}
+
+	rootDir, _, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return nil, err
+	}
+	st, err := state.Load(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	st.Apply(worktrees)
+
+	if err := worktree.Sort(worktrees, order); err != nil {
+		return nil, err
+	}
+	return worktrees, nil
+}
+
+// updateState records a change in the state store of the repository
+// gw keeps working without it, so a failure is only a warning.
+func updateState(rootDir string, fn func(s *state.Store)) {
+	if err := state.Update(rootDir, fn); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// statusEnabled reports whether GW_LIST_STATUS asks for status columns by default
+func statusEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("GW_LIST_STATUS"))
+	return enabled
+}
+
+// formatWorktrees formats worktrees for gw list and the selectors,
+// optionally with status columns aligned to the terminal width
+func formatWorktrees(worktrees []worktree.Worktree, withStatus, color bool) []string {
+	if !withStatus {
+		lines := make([]string, len(worktrees))
+		for i, wt := range worktrees {
+			lines[i] = worktree.Format(wt)
+		}
+		return lines
+	}
+
+	worktree.LoadStatus(worktrees, branch.GetDefaultRef())
+	return worktree.FormatTable(worktrees, ui.TerminalWidth(), color)
+}
+
+func runCD(args []string) error {
+	fs := flag.NewFlagSet("cd", flag.ContinueOnError)
+	sortOrder := fs.String("sort", "frecency", "sort order: "+strings.Join(worktree.SortOrders, ", "))
+	history := fs.Bool("history", false, "select from recently visited worktrees, most recent first")
+	root := fs.Bool("root", false, "go to the root of the worktree instead of the same subdirectory")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw cd [--sort <order>] [--history] [--root] [query | -]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+	var query string
+	if len(positional) == 1 {
+		query = positional[0]
+	}
+
+	// Get worktree list, most frequently and recently visited first
+	allWorktrees, err := listSorted(*sortOrder)
 	if err != nil {
 		return err
 	}
 
+	// A bare repository and worktrees whose directory is gone can't be entered
+	var worktrees []worktree.Worktree
+	for _, wt := range allWorktrees {
+		if wt.IsBare || wt.Prunable {
+			continue
+		}
+		worktrees = append(worktrees, wt)
+	}
+
 	if len(worktrees) == 0 {
 		return fmt.Errorf("no worktrees found")
 	}
 
-	// Format worktrees for selection
-	items := make([]string, len(worktrees))
-	for i, wt := range worktrees {
-		items[i] = worktree.Format(wt)
+	rootDir, repoName, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return err
+	}
+
+	if *history {
+		worktrees = visitedWorktrees(worktrees, rootDir)
+		if len(worktrees) == 0 {
+			return fmt.Errorf("no visited worktrees found")
+		}
 	}
 
-	// Let user select with peco
-	selected, err := ui.SelectWithPeco(items)
+	// Go back to the previous worktree, straight to the worktree the query refers to,
+	// or let user select one
+	var selectedWorktree *worktree.Worktree
+	if query == "-" {
+		selectedWorktree, err = previousWorktree(worktrees, rootDir)
+	} else {
+		selectedWorktree, err = resolveWorktree(worktrees, query)
+	}
 	if err != nil {
 		if errors.Is(err, ui.ErrCancelled) {
 			return nil
 		}
-		return fmt.Errorf("failed to select worktree: %w", err)
+		return err
 	}
 
-	// Find the selected worktree
-	var selectedWorktree *worktree.Worktree
-	for i, item := range items {
-		if item == selected {
-			selectedWorktree = &worktrees[i]
-			break
-		}
+	dir := selectedWorktree.Path
+	if !*root {
+		dir = sameSubdir(dir)
 	}
 
-	if selectedWorktree == nil {
-		return fmt.Errorf("selected worktree not found")
+	return enterWorktree(selectedWorktree.Path, dir, selectedWorktree.Branch, rootDir, repoName)
+}
+
+// sameSubdir returns the directory in the worktree at target that corresponds to
+// the current directory in the current worktree, or its nearest existing parent
+// Outside a worktree it returns target.
+func sameSubdir(target string) string {
+	current, err := worktree.CurrentPath()
+	if err != nil {
+		return target
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return target
+	}
+	// git reports the worktree with symlinks resolved
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = resolved
 	}
 
-	// Output cd command for shell wrapper to evaluate
-	fmt.Printf("cd %q", selectedWorktree.Path)
+	rel, err := filepath.Rel(current, cwd)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return target
+	}
 
-	return nil
+	for dir := filepath.Join(target, rel); dir != target; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return target
 }
 
 func runRM(args []string) error {
-	// Get worktree list
-	allWorktrees, err := worktree.List()
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	includeLocked := fs.Bool("locked", false, "also offer locked worktrees for removal (unlocks them)")
+	current := fs.Bool("current", false, "remove the worktree containing the current directory")
+	force := fs.Bool("force", false, "don't ask to type a confirmation when unsaved work would be lost")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw rm [--locked] [--force] [--current | query...]")
+		fs.PrintDefaults()
+	}
+	queries, err := parseFlags(fs, args)
 	if err != nil {
 		return err
 	}
+	if *current && len(queries) > 0 {
+		return fmt.Errorf("--current can't be combined with queries")
+	}
 
-	// Get current directory to exclude current worktree
-	cwd, err := os.Getwd()
+	// Get worktree list, most recently active first
+	allWorktrees, err := listSorted("activity")
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
+	}
+
+	if *current {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		wt, err := currentWorktree(allWorktrees, cwd, *includeLocked)
+		if err != nil {
+			return err
+		}
+		allWorktrees = []worktree.Worktree{*wt}
 	}
 
-	// Filter out main worktree and current worktree
+	// Filter out main worktree, bare repository and locked worktrees
 	var worktrees []worktree.Worktree
+	var locked int
 	for _, wt := range allWorktrees {
-		if wt.IsMain {
+		if wt.IsMain || wt.IsBare {
 			continue
 		}
-		// Check if current directory is within this worktree
-		if strings.HasPrefix(cwd, wt.Path) {
+		if wt.Locked && !*includeLocked {
+			locked++
 			continue
 		}
 		worktrees = append(worktrees, wt)
 	}
 
+	if locked > 0 {
+		fmt.Fprintf(os.Stderr, "%d locked worktree(s) hidden (use --locked to include them)\n", locked)
+	}
+
 	if len(worktrees) == 0 {
 		if verbose {
 			fmt.Println("No additional worktrees found (main worktree cannot be removed)")
@@ -251,36 +870,22 @@ func runRM(args []string) error {
 		return nil
 	}
 
-	// Format worktrees for selection
-	items := make([]string, len(worktrees))
-	for i, wt := range worktrees {
-		items[i] = worktree.Format(wt)
-	}
-
-	// Let user select multiple worktrees (fzf or peco)
-	selected, err := ui.MultiSelect(items)
-	if err != nil {
-		if errors.Is(err, ui.ErrCancelled) {
-			return nil
+	// Resolve the queries, or let user select multiple worktrees
+	selectedWorktrees := worktrees
+	if !*current {
+		selectedWorktrees, err = resolveWorktrees(worktrees, queries)
+		if err != nil {
+			if errors.Is(err, ui.ErrCancelled) {
+				return nil
+			}
+			return err
 		}
-		return fmt.Errorf("failed to select worktrees: %w", err)
 	}
 
-	if len(selected) == 0 {
+	if len(selectedWorktrees) == 0 {
 		return nil
 	}
 
-	// Find the selected worktrees
-	var selectedWorktrees []worktree.Worktree
-	for _, sel := range selected {
-		for i, item := range items {
-			if item == sel {
-				selectedWorktrees = append(selectedWorktrees, worktrees[i])
-				break
-			}
-		}
-	}
-
 	// Get default branch name
 	defaultBranch, err := branch.GetDefaultBranch()
 	if err != nil {
@@ -294,50 +899,58 @@ func runRM(args []string) error {
 		}
 	}
 
-	// Show what will be deleted
-	fmt.Printf("\nThe following worktrees will be removed:\n")
-	for _, wt := range selectedWorktrees {
-		fmt.Printf("  - %s (%s)\n", wt.Branch, wt.Path)
+	// Find uncommitted changes, stashes and unpushed commits that would be lost;
+	// the default branch may only exist on origin
+	defaultRef := branch.GetDefaultRef()
+	removals := make([]removal, len(selectedWorktrees))
+	for i, wt := range selectedWorktrees {
+		unsaved, err := worktree.FindUnsaved(wt, defaultRef)
+		if err != nil {
+			// A worktree that can't be checked may hold anything
+			if !*force {
+				return fmt.Errorf("failed to check %s for unsaved work (use --force to remove it anyway): %w", worktree.Label(wt), err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: failed to check %s for unsaved work: %v\n", worktree.Label(wt), err)
+		}
+		removals[i] = removal{Worktree: wt, unsaved: unsaved}
 	}
-	fmt.Println()
 
-	// Confirm deletion
-	confirmed, err := ui.Confirm("Are you sure you want to remove these worktrees?")
-	if err != nil {
-		return err
+	return removeWorktrees(removals, defaultRef, removeOptions{force: *force})
+}
+
+// currentWorktree returns the worktree containing cwd if it can be removed
+func currentWorktree(worktrees []worktree.Worktree, cwd string, includeLocked bool) (*worktree.Worktree, error) {
+	// Worktrees may be nested, so the deepest one containing cwd wins
+	var current *worktree.Worktree
+	for i, wt := range worktrees {
+		if !wt.IsBare && within(wt.Path, cwd) && (current == nil || within(current.Path, wt.Path)) {
+			current = &worktrees[i]
+		}
 	}
 
-	if !confirmed {
-		return nil
+	switch {
+	case current == nil:
+		return nil, fmt.Errorf("the current directory is not in a worktree")
+	case current.IsMain:
+		return nil, fmt.Errorf("the main worktree cannot be removed")
+	case current.Locked && !includeLocked:
+		return nil, fmt.Errorf("the current worktree is locked (use --locked to remove it)")
 	}
+	return current, nil
+}
 
-	// Remove worktrees and their branches
-	for _, wt := range selectedWorktrees {
-		if verbose {
-			fmt.Printf("Removing worktree %s...\n", wt.Branch)
-		}
-		if err := worktree.Remove(wt.Path); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to remove worktree %s: %v\n", wt.Branch, err)
-			continue
-		}
-		if verbose {
-			fmt.Printf("✓ Removed worktree %s\n", wt.Branch)
-		}
+// within reports whether path is dir or inside it, after resolving symlinks in both
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(resolvePath(dir), resolvePath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
-		// Remove associated branch
-		if verbose {
-			fmt.Printf("Removing branch %s...\n", wt.Branch)
-		}
-		if err := worktree.RemoveBranch(wt.Branch); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to remove branch %s: %v\n", wt.Branch, err)
-			continue
-		}
-		if verbose {
-			fmt.Printf("✓ Removed branch %s\n", wt.Branch)
-		}
+// resolvePath returns path with symlinks resolved, or cleaned if it can't be resolved
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
 	}
-
-	return nil
+	return filepath.Clean(path)
 }
 
 func runPR(args []string) error {
@@ -473,8 +1086,8 @@ func runLnRm(args []string) error {
 		return nil
 	}
 
-	// Let user select with peco/fzf
-	selected, err := ui.SelectWithPeco(items)
+	// Let user select with the configured selector
+	selected, err := ui.Select(items, ui.SelectOptions{Prompt: "Stop sharing> "})
 	if err != nil {
 		if errors.Is(err, ui.ErrCancelled) {
 			return nil
@@ -488,11 +1101,12 @@ func runLnRm(args []string) error {
 		return err
 	}
 
-	if len(worktrees) == 0 {
-		return fmt.Errorf("no worktrees found")
+	mainWorktree := worktree.Main(worktrees)
+	if mainWorktree == nil {
+		return fmt.Errorf("main worktree not found (bare repository)")
 	}
 
-	mainWorktreePath := worktrees[0].Path
+	mainWorktreePath := mainWorktree.Path
 
 	// Remove from .gw-links and move to main worktree
 	if err := link.Remove(selected, rootDir, mainWorktreePath); err != nil {
@@ -507,30 +1121,15 @@ func runLnRm(args []string) error {
 }
 
 func runPRCheckout(args []string) error {
-	// Run gh pr checkout and capture the branch name
-	ghArgs := append([]string{"pr", "checkout"}, args...)
-	cmd := exec.Command("gh", ghArgs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	output, err := cmd.Output()
+	// --cd is gw's own flag; everything else goes to gh pr checkout
+	args, cd, err := extractCDFlag(args)
 	if err != nil {
-		return fmt.Errorf("gh pr checkout failed: %w", err)
-	}
-
-	// Get current branch name (gh pr checkout switches to the PR branch)
-	branchCmd := exec.Command("git", "branch", "--show-current")
-	branchOutput, err := branchCmd.Output()
-	if err != nil {
-		return fmt.Errorf("failed to get current branch: %w", err)
-	}
-	branchName := strings.TrimSpace(string(branchOutput))
-
-	if branchName == "" {
-		return fmt.Errorf("failed to determine checked out branch")
+		return err
 	}
 
-	if verbose {
-		fmt.Printf("Checked out branch: %s\n", branchName)
+	// Validate configuration before touching the current worktree
+	if _, err := worktree.GetPathTemplate(); err != nil {
+		return err
 	}
 
 	// Get worktree root directory
@@ -539,36 +1138,98 @@ func runPRCheckout(args []string) error {
 		return err
 	}
 
-	// Generate worktree path
-	wtPath := worktree.GenerateWorktreePath(branchName, rootDir, repoName)
-	if verbose {
-		fmt.Printf("Creating worktree at: %s\n", wtPath)
-	}
-
-	// Switch back to previous branch before creating worktree
-	// (we need to detach the branch from current worktree)
-	prevBranchCmd := exec.Command("git", "checkout", "-")
-	prevBranchCmd.Stdout = os.Stdout
-	prevBranchCmd.Stderr = os.Stderr
-	if err := prevBranchCmd.Run(); err != nil {
-		return fmt.Errorf("failed to switch back to previous branch: %w", err)
-	}
-
-	// Create worktree for existing branch
-	if err := worktree.AddExistingBranch(wtPath, branchName); err != nil {
+	// Local branches before checkout tell whether gh created the PR branch
+	existing, err := branch.ListLocal()
+	if err != nil {
 		return err
 	}
 
-	// Create symlinks for shared files
-	warnings := link.CreateSymlinks(wtPath, rootDir)
-	for _, w := range warnings {
-		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	target := &worktreeTarget{RootDir: rootDir}
+	var output []byte
+	var created bool
+
+	steps := []txn.Step{
+		{
+			Name: "check out PR branch",
+			Do: func() error {
+				// Run gh pr checkout and capture the branch name
+				ghArgs := append([]string{"pr", "checkout"}, args...)
+				cmd := exec.Command("gh", ghArgs...)
+				cmd.Stdin = os.Stdin
+				cmd.Stderr = os.Stderr
+				out, err := cmd.Output()
+				if err != nil {
+					return fmt.Errorf("gh pr checkout failed: %w", err)
+				}
+				output = out
+
+				// Get current branch name (gh pr checkout switches to the PR branch)
+				branchName, err := branch.GetCurrentBranch()
+				if err != nil {
+					return err
+				}
+				if branchName == "" {
+					return fmt.Errorf("failed to determine checked out branch")
+				}
+				created = !slices.Contains(existing, branchName)
+
+				if verbose {
+					fmt.Printf("Checked out branch: %s\n", branchName)
+				}
+
+				// Generate worktree path
+				target.Branch = branchName
+				target.Path, err = worktree.GenerateWorktreePath(branchName, branchName, rootDir, repoName)
+				if err != nil {
+					return err
+				}
+				if verbose {
+					fmt.Printf("Creating worktree at: %s\n", target.Path)
+				}
+				return nil
+			},
+			Undo: func() error {
+				if current, err := branch.GetCurrentBranch(); err == nil && current == target.Branch {
+					if err := checkoutPrevious(); err != nil {
+						return err
+					}
+				}
+				if created {
+					return worktree.RemoveBranch(target.Branch)
+				}
+				return nil
+			},
+		},
+		{
+			// Switch back to previous branch before creating worktree
+			// (we need to detach the branch from current worktree)
+			Name: "switch back to previous branch",
+			Do:   checkoutPrevious,
+		},
+		{
+			Name: "run pre-add hook",
+			Do: func() error {
+				env, err := newHookEnv(target.Path, target.Branch, rootDir, repoName)
+				if err != nil {
+					return err
+				}
+				return hook.Run(hook.PreAdd, env)
+			},
+		},
+		containerStep(target),
+	}
+	steps = append(steps, worktreeSteps(target)...)
+	steps = append(steps, postAddStep(target, repoName))
+
+	if err := txn.Run(steps); err != nil {
+		return err
 	}
+	updateState(rootDir, func(s *state.Store) { s.RecordCreated(target.Path) })
 
 	if verbose {
 		fmt.Printf("✓ Successfully created worktree\n")
-		fmt.Printf("  Branch: %s\n", branchName)
-		fmt.Printf("  Path: %s\n", wtPath)
+		fmt.Printf("  Branch: %s\n", target.Branch)
+		fmt.Printf("  Path: %s\n", target.Path)
 	}
 
 	// Print any output from gh pr checkout
@@ -576,5 +1237,126 @@ func runPRCheckout(args []string) error {
 		fmt.Print(string(output))
 	}
 
+	if cd {
+		return enterNewWorktree(target.Path, target.Branch, rootDir, repoName)
+	}
+
 	return nil
 }
+
+// extractCDFlag removes --cd (or --cd=<bool>) from args and returns its value,
+// which defaults to $GW_ADD_CD
+func extractCDFlag(args []string) ([]string, bool, error) {
+	cd := addCDEnabled()
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case arg == "--cd":
+			cd = true
+		case strings.HasPrefix(arg, "--cd="):
+			value, err := strconv.ParseBool(strings.TrimPrefix(arg, "--cd="))
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid %s: %w", arg, err)
+			}
+			cd = value
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, cd, nil
+}
+
+func checkoutPrevious() error {
+	cmd := exec.Command("git", "checkout", "-")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to switch back to previous branch: %w", err)
+	}
+	return nil
+}
+
+// worktreeTarget describes a worktree being created by gw add or gw pr checkout
+// Fields may be filled in by earlier steps of the same transaction.
+type worktreeTarget struct {
+	Path    string
+	Branch  string
+	RootDir string
+}
+
+// postAddStep runs the post-add hook in the new worktree
+// A failing hook rolls back the whole creation like any other step.
+func postAddStep(target *worktreeTarget, repoName string) txn.Step {
+	return txn.Step{
+		Name: "run post-add hook",
+		Do: func() error {
+			env, err := newHookEnv(target.Path, target.Branch, target.RootDir, repoName)
+			if err != nil {
+				return err
+			}
+			return hook.Run(hook.PostAdd, env)
+		},
+	}
+}
+
+// newHookEnv describes a worktree for hooks
+func newHookEnv(path, branchName, rootDir, repoName string) (hook.Env, error) {
+	mainPath, err := worktree.MainPath()
+	if err != nil {
+		return hook.Env{}, err
+	}
+	return hook.Env{
+		Path:         path,
+		Branch:       branchName,
+		Repo:         repoName,
+		Root:         rootDir,
+		MainWorktree: mainPath,
+	}, nil
+}
+
+// containerStep creates the directory that holds the worktree
+func containerStep(target *worktreeTarget) txn.Step {
+	var mkdir txn.Step
+	return txn.Step{
+		Name: "create container directory",
+		Do: func() error {
+			// The path may only be known once earlier steps have run
+			mkdir = txn.MkdirAll("create container directory", filepath.Dir(target.Path))
+			return mkdir.Do()
+		},
+		Undo: func() error {
+			return mkdir.Undo()
+		},
+	}
+}
+
+// worktreeSteps returns the steps that create a worktree for an existing branch
+// and link shared files into it
+func worktreeSteps(target *worktreeTarget) []txn.Step {
+	return []txn.Step{
+		{
+			Name: "create worktree",
+			Do: func() error {
+				return worktree.AddExistingBranch(target.Path, target.Branch)
+			},
+			Undo: func() error {
+				return worktree.Remove(target.Path)
+			},
+		},
+		{
+			// Symlinks go away together with the worktree
+			Name: "link shared files",
+			Do: func() error {
+				warnings, err := link.CreateSymlinks(target.Path, target.RootDir)
+				for _, w := range warnings {
+					fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+				}
+				return err
+			},
+		},
+	}
+}
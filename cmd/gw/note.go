@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/qawatake/gw/internal/branch"
+	"github.com/qawatake/gw/internal/ui"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+func runNote(args []string) error {
+	fs := flag.NewFlagSet("note", flag.ContinueOnError)
+	selectFlag := fs.Bool("s", false, "select the worktree even when inside one")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw note [-s] [query]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+	var query string
+	if len(positional) == 1 {
+		query = positional[0]
+	}
+
+	rootDir, repoName, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return err
+	}
+
+	worktrees, err := worktree.List()
+	if err != nil {
+		return err
+	}
+
+	// Only worktrees created under the worktree root have a notes file
+	var candidates []worktree.Worktree
+	for _, wt := range worktrees {
+		if !wt.Prunable && worktree.NotesPath(wt.Path, rootDir, repoName) != "" {
+			candidates = append(candidates, wt)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no worktrees with notes found")
+	}
+
+	var target *worktree.Worktree
+	if !*selectFlag && query == "" {
+		if current, err := worktree.CurrentPath(); err == nil {
+			for i := range candidates {
+				if candidates[i].Path == current {
+					target = &candidates[i]
+					break
+				}
+			}
+		}
+	}
+
+	if target == nil {
+		target, err = resolveWorktree(candidates, query)
+		if err != nil {
+			if errors.Is(err, ui.ErrCancelled) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	notesPath := worktree.NotesPath(target.Path, rootDir, repoName)
+
+	// Start a missing notes file from the branch description
+	if _, err := os.Stat(notesPath); os.IsNotExist(err) {
+		if description := branch.GetDescription(target.Branch); description != "" {
+			if err := os.WriteFile(notesPath, []byte(description+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write notes: %w", err)
+			}
+		}
+	}
+
+	return ui.OpenInEditor(notesPath)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/qawatake/gw/internal/branch"
+	"github.com/qawatake/gw/internal/shell"
+	"github.com/qawatake/gw/internal/ui"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+// previewCommits and previewNotes bound the length of the preview
+const (
+	previewCommits = 10
+	previewNotes   = 20
+)
+
+// previewCommand returns the preview command passed to selectors
+// "{}" is replaced by the selector with the highlighted line.
+func previewCommand() string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "gw"
+	}
+	return shell.Quote(exe) + " __preview {}"
+}
+
+// runPreview prints details of a worktree for the preview pane of selectors
+// The argument is a worktree path or a selector line ending with one.
+func runPreview(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gw __preview <path-or-line>")
+	}
+	path := previewPath(args[0])
+	if path == "" {
+		return fmt.Errorf("no worktree found in %q", args[0])
+	}
+
+	worktrees, err := worktree.List()
+	if err != nil {
+		return err
+	}
+	var wt *worktree.Worktree
+	for i := range worktrees {
+		if worktrees[i].Path == path {
+			wt = &worktrees[i]
+			break
+		}
+	}
+	if wt == nil {
+		return fmt.Errorf("%s is not a worktree", path)
+	}
+
+	statuses := []worktree.Worktree{*wt}
+	worktree.LoadStatus(statuses, branch.GetDefaultRef())
+	status := statuses[0].Status
+
+	fmt.Printf("%s\n%s\n", worktree.Label(*wt), wt.Path)
+
+	var tracking []string
+	if status.HasUpstream {
+		tracking = append(tracking, fmt.Sprintf("upstream: ↑%d ↓%d", status.Ahead, status.Behind))
+	}
+	if status.DefaultBranch != "" {
+		tracking = append(tracking, fmt.Sprintf("%s: ↑%d ↓%d", status.DefaultBranch, status.AheadDefault, status.BehindDefault))
+	}
+	if len(tracking) > 0 {
+		fmt.Println(strings.Join(tracking, "  "))
+	}
+	if base := branch.GetBase(wt.Branch); base != "" && !wt.Detached {
+		if count, err := branch.CommitsSinceBase(wt.Branch); err == nil {
+			fmt.Printf("base: %s (%d commits since)\n", base, count)
+		}
+	}
+
+	if wt.Prunable {
+		fmt.Printf("\nprunable: %s\n", wt.PrunableReason)
+		return nil
+	}
+
+	if changes, err := worktree.ShortStatus(wt.Path); err == nil {
+		fmt.Println()
+		if changes == "" {
+			fmt.Println("Clean")
+		} else {
+			fmt.Println("Changes:")
+			fmt.Print(changes)
+		}
+	}
+
+	if commits, err := worktree.RecentCommits(wt.Path, previewCommits); err == nil && commits != "" {
+		fmt.Println()
+		fmt.Println("Recent commits:")
+		fmt.Print(commits)
+	}
+
+	rootDir, repoName, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return nil
+	}
+	if notesPath := worktree.NotesPath(wt.Path, rootDir, repoName); notesPath != "" {
+		if notes, err := os.ReadFile(notesPath); err == nil && len(strings.TrimSpace(string(notes))) > 0 {
+			lines := strings.Split(strings.TrimRight(string(notes), "\n"), "\n")
+			fmt.Println()
+			fmt.Println("Notes:")
+			for i, line := range lines {
+				if i == previewNotes {
+					fmt.Printf("... (%d more lines)\n", len(lines)-previewNotes)
+					break
+				}
+				fmt.Println(line)
+			}
+		}
+	}
+
+	return nil
+}
+
+// previewPath returns the worktree path in s, which is a path or a selector line
+// ending with one. The path may start with "~" and may contain spaces, so the
+// longest suffix that is an existing directory wins; for a worktree whose
+// directory is gone, the last word is used.
+func previewPath(s string) string {
+	s = strings.TrimSpace(s)
+	var last string
+	for i, r := range s {
+		if prev, _ := utf8.DecodeLastRuneInString(s[:i]); unicode.IsSpace(r) || (i > 0 && !unicode.IsSpace(prev)) {
+			continue
+		}
+		last = expandHome(s[i:])
+		if info, err := os.Stat(last); err == nil && info.IsDir() {
+			return last
+		}
+	}
+	return last
+}
+
+// expandHome replaces a leading "~/" in path with the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
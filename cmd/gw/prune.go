@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/qawatake/gw/internal/hook"
+	"github.com/qawatake/gw/internal/state"
+	"github.com/qawatake/gw/internal/ui"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only show what would be cleaned")
+	branches := fs.Bool("branches", false, "also delete the branches of pruned worktrees")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gw prune [--dry-run] [--branches] [--yes]")
+		fs.PrintDefaults()
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	allWorktrees, err := worktree.List()
+	if err != nil {
+		return err
+	}
+
+	// git never prunes locked worktrees
+	var worktrees []worktree.Worktree
+	for _, wt := range allWorktrees {
+		if !wt.Prunable {
+			continue
+		}
+		if wt.Locked {
+			fmt.Fprintf(os.Stderr, "Skipped locked worktree %s (unlock it with: git worktree unlock %s)\n", wt.Path, wt.Path)
+			continue
+		}
+		worktrees = append(worktrees, wt)
+	}
+
+	if len(worktrees) == 0 {
+		if verbose {
+			fmt.Println("No prunable worktrees found")
+		}
+		return nil
+	}
+
+	rootDir, repoName, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return err
+	}
+
+	// Show what will be cleaned
+	fmt.Printf("The following worktrees will be pruned:\n")
+	for _, wt := range worktrees {
+		fmt.Printf("  - %s (%s)\n", worktree.Label(wt), wt.Path)
+		if wt.PrunableReason != "" {
+			fmt.Printf("      reason: %s\n", wt.PrunableReason)
+		}
+		if *branches && !wt.Detached {
+			fmt.Printf("      delete branch: %s\n", wt.Branch)
+		}
+		if dir := worktree.ContainerDir(wt.Path, rootDir, repoName); dir != "" {
+			fmt.Printf("      remove directory: %s\n", dir)
+		}
+	}
+	fmt.Println()
+
+	if *dryRun {
+		return nil
+	}
+
+	if !*yes {
+		confirmed, err := ui.Confirm("Are you sure you want to prune these worktrees?")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return nil
+		}
+	}
+
+	// Prune the git metadata of all of them at once
+	if err := worktree.Prune(); err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("✓ Pruned worktree metadata\n")
+	}
+
+	updateState(rootDir, func(s *state.Store) {
+		for _, wt := range worktrees {
+			s.Forget(wt.Path)
+		}
+	})
+
+	for _, wt := range worktrees {
+		if *branches && !wt.Detached {
+			if err := worktree.RemoveBranch(wt.Branch); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove branch %s: %v\n", wt.Branch, err)
+			} else if verbose {
+				fmt.Printf("✓ Removed branch %s\n", wt.Branch)
+			}
+		}
+
+		removed, err := worktree.RemoveContainer(wt.Path, rootDir, repoName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to clean up %s: %v\n", wt.Path, err)
+		} else if !removed {
+			if dir := worktree.ContainerDir(wt.Path, rootDir, repoName); dir != "" {
+				fmt.Fprintf(os.Stderr, "Warning: kept %s (contains other files)\n", dir)
+			}
+		}
+
+		// Let teardown hooks run for worktrees that disappeared
+		env, err := newHookEnv(wt.Path, wt.Branch, rootDir, repoName)
+		if err != nil {
+			return err
+		}
+		if err := hook.Run(hook.PostRm, env); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	return nil
+}
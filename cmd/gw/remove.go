@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/qawatake/gw/internal/directive"
+	"github.com/qawatake/gw/internal/hook"
+	"github.com/qawatake/gw/internal/state"
+	"github.com/qawatake/gw/internal/ui"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+// removal is a worktree to remove along with the work removing it would lose
+type removal struct {
+	worktree.Worktree
+	unsaved worktree.Unsaved
+	reason  string // why the worktree is removed, shown in the plan if set
+}
+
+// removeOptions controls removeWorktrees
+type removeOptions struct {
+	dryRun bool // only show the plan
+	yes    bool // don't ask for confirmation
+	force  bool // don't ask to type a confirmation when unsaved work would be lost
+}
+
+// removeWorktrees shows the plan, asks for confirmation and removes the
+// worktrees and their branches, running the rm hooks around each
+// If the shell is inside one of them, it is moved to the main worktree.
+func removeWorktrees(removals []removal, defaultRef string, opts removeOptions) error {
+	var losesWork bool
+	for _, r := range removals {
+		losesWork = losesWork || !r.unsaved.Empty()
+	}
+
+	// Show what will be deleted
+	fmt.Printf("\nThe following worktrees will be removed:\n")
+	for _, r := range removals {
+		fmt.Printf("  - %s (%s)\n", worktree.Label(r.Worktree), r.Path)
+		if r.reason != "" {
+			fmt.Printf("      %s\n", r.reason)
+		}
+		printUnsaved(r.unsaved, defaultRef)
+	}
+	fmt.Println()
+
+	if opts.dryRun {
+		return nil
+	}
+
+	// Confirm deletion; losing work takes more than a "y"
+	var confirmed bool
+	var err error
+	switch {
+	case losesWork && !opts.force:
+		if opts.yes {
+			return fmt.Errorf("the work marked with ! would be lost (use --force to remove anyway)")
+		}
+		confirmed, err = ui.ConfirmTyped("The work marked with ! will be lost.", "delete")
+	case opts.yes:
+		confirmed = true
+	default:
+		confirmed, err = ui.Confirm("Are you sure you want to remove these worktrees?")
+	}
+	if err != nil {
+		return err
+	}
+
+	if !confirmed {
+		return nil
+	}
+
+	rootDir, repoName, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// git can't run in a removed directory, so move to the main worktree first
+	var mainPath, inside string
+	for _, r := range removals {
+		if within(r.Path, cwd) {
+			inside = r.Path
+			mainPath, err = worktree.MainPath()
+			if err != nil {
+				return err
+			}
+			if err := os.Chdir(mainPath); err != nil {
+				return fmt.Errorf("failed to leave %s: %w", r.Path, err)
+			}
+			break
+		}
+	}
+
+	// Remove worktrees and their branches
+	var removed []string
+	for _, r := range removals {
+		wt := r.Worktree
+		env, err := newHookEnv(wt.Path, wt.Branch, rootDir, repoName)
+		if err != nil {
+			return err
+		}
+		if err := hook.Run(hook.PreRm, env); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipped %s: %v\n", worktree.Label(wt), err)
+			continue
+		}
+
+		if verbose {
+			fmt.Printf("Removing worktree %s...\n", worktree.Label(wt))
+		}
+		if err := removeWorktree(wt); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove worktree %s: %v\n", worktree.Label(wt), err)
+			continue
+		}
+		if verbose {
+			fmt.Printf("✓ Removed worktree %s\n", worktree.Label(wt))
+		}
+		removed = append(removed, wt.Path)
+		updateState(rootDir, func(s *state.Store) { s.Forget(wt.Path) })
+
+		// Detached worktrees have no branch to remove
+		if wt.Detached {
+			if err := hook.Run(hook.PostRm, env); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			continue
+		}
+
+		// Remove associated branch
+		if verbose {
+			fmt.Printf("Removing branch %s...\n", wt.Branch)
+		}
+		if err := worktree.RemoveBranch(wt.Branch); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove branch %s: %v\n", wt.Branch, err)
+			continue
+		}
+		if verbose {
+			fmt.Printf("✓ Removed branch %s\n", wt.Branch)
+		}
+
+		if err := hook.Run(hook.PostRm, env); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	// Move the shell out of the removed worktree it was in
+	if inside != "" && slices.Contains(removed, inside) {
+		if !directive.Available() {
+			fmt.Fprintf(os.Stderr, "The current directory was removed; the main worktree is %s\n", mainPath)
+			return nil
+		}
+		return directive.CD(mainPath)
+	}
+
+	return nil
+}
+
+// removeWorktree removes a listed worktree
+// git also removes the entry of a worktree whose directory is gone. A locked
+// worktree is unlocked first.
+func removeWorktree(wt worktree.Worktree) error {
+	if wt.Locked {
+		if err := worktree.Unlock(wt.Path); err != nil {
+			return err
+		}
+	}
+	return worktree.Remove(wt.Path)
+}
+
+// maxUnsavedCommits is the number of unsaved commits listed per worktree
+const maxUnsavedCommits = 5
+
+// printUnsaved lists the work that removing a worktree would lose
+// Summary puts the commits last, so they are listed under their summary line.
+func printUnsaved(u worktree.Unsaved, defaultRef string) {
+	for _, line := range u.Summary(defaultRef) {
+		fmt.Printf("      ! %s\n", line)
+	}
+	for i, commit := range u.Commits {
+		if i == maxUnsavedCommits {
+			fmt.Printf("          ... and %d more\n", len(u.Commits)-i)
+			break
+		}
+		fmt.Printf("          %s\n", commit)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/qawatake/gw/internal/ui"
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+// resolveWorktree returns the worktree that query refers to
+// If query is empty or matches several worktrees, the user selects one of the
+// candidates in a selector pre-filtered with query.
+// ui.ErrCancelled is returned if the selection is cancelled.
+func resolveWorktree(worktrees []worktree.Worktree, query string) (*worktree.Worktree, error) {
+	candidates, err := matchWorktrees(worktrees, query)
+	if err != nil {
+		return nil, err
+	}
+	if query != "" && len(candidates) == 1 {
+		return &candidates[0], nil
+	}
+
+	// Format worktrees for selection
+	items := formatWorktrees(candidates, statusEnabled(), false)
+
+	selected, err := ui.Select(items, ui.SelectOptions{
+		Prompt:  "Select worktree> ",
+		Query:   query,
+		Preview: previewCommand(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select worktree: %w", err)
+	}
+	for i, item := range items {
+		if item == selected {
+			return &candidates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("selected worktree not found")
+}
+
+// resolveWorktrees returns the worktrees that queries refer to
+// Each query that matches several worktrees opens a multi-select pre-filtered
+// with it; without queries the user selects from all worktrees.
+// ui.ErrCancelled is returned if a selection is cancelled.
+func resolveWorktrees(worktrees []worktree.Worktree, queries []string) ([]worktree.Worktree, error) {
+	if len(queries) == 0 {
+		return multiSelectWorktrees(worktrees, "")
+	}
+
+	var resolved []worktree.Worktree
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		candidates, err := matchWorktrees(worktrees, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) > 1 {
+			candidates, err = multiSelectWorktrees(candidates, query)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, wt := range candidates {
+			if !seen[wt.Path] {
+				seen[wt.Path] = true
+				resolved = append(resolved, wt)
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// matchWorktrees returns the worktrees that query refers to, or all of them if query is empty
+func matchWorktrees(worktrees []worktree.Worktree, query string) ([]worktree.Worktree, error) {
+	if query == "" {
+		return worktrees, nil
+	}
+
+	rootDir, repoName, err := ui.GetWorktreeRoot()
+	if err != nil {
+		return nil, err
+	}
+	matches := worktree.Resolve(worktrees, query, rootDir, repoName)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no worktree matches %q", query)
+	}
+	return matches, nil
+}
+
+// multiSelectWorktrees lets the user select any number of worktrees
+func multiSelectWorktrees(worktrees []worktree.Worktree, query string) ([]worktree.Worktree, error) {
+	// Format worktrees for selection
+	items := formatWorktrees(worktrees, statusEnabled(), false)
+
+	selected, err := ui.MultiSelect(items, ui.SelectOptions{Query: query, Preview: previewCommand()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select worktrees: %w", err)
+	}
+
+	var result []worktree.Worktree
+	for _, sel := range selected {
+		for i, item := range items {
+			if item == sel {
+				result = append(result, worktrees[i])
+				break
+			}
+		}
+	}
+	return result, nil
+}
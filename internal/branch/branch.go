@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -51,6 +53,127 @@ func GenerateBranchName(name string) (string, error) {
 	return prefix + name, nil
 }
 
+// ValidateName checks a branch name the way `git check-ref-format --branch` does,
+// and against the team policy in GW_BRANCH_POLICY if configured
+func ValidateName(branchName string) error {
+	if err := checkRefFormat(branchName); err != nil {
+		return err
+	}
+
+	policy := os.Getenv("GW_BRANCH_POLICY")
+	if policy == "" {
+		return nil
+	}
+	re, err := regexp.Compile(policy)
+	if err != nil {
+		return fmt.Errorf("invalid GW_BRANCH_POLICY: %w", err)
+	}
+	if !re.MatchString(branchName) {
+		return fmt.Errorf("does not match the branch policy %s", policy)
+	}
+	return nil
+}
+
+// checkRefFormat implements the rules of git-check-ref-format(1) for branch names
+func checkRefFormat(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("must not be empty")
+	case name == "@" || name == "HEAD":
+		return fmt.Errorf("%q is reserved", name)
+	case strings.HasPrefix(name, "-"):
+		return fmt.Errorf("must not begin with '-'")
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return fmt.Errorf("must not begin or end with '/'")
+	case strings.Contains(name, "//"):
+		return fmt.Errorf("must not contain consecutive slashes")
+	case strings.HasSuffix(name, "."):
+		return fmt.Errorf("must not end with '.'")
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("must not contain '..'")
+	case strings.Contains(name, "@{"):
+		return fmt.Errorf("must not contain '@{'")
+	}
+
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("must not contain control characters")
+		}
+		if strings.ContainsRune(refForbiddenChars, r) {
+			return fmt.Errorf("must not contain %q", r)
+		}
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return fmt.Errorf("component %q must not begin with '.'", component)
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("component %q must not end with '.lock'", component)
+		}
+	}
+	return nil
+}
+
+// refForbiddenChars are the characters git never allows in a ref name
+const refForbiddenChars = " ~^:?*[\\"
+
+// transliterations maps common non-ASCII letters to ASCII
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ł': "l", 'ľ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'œ': "oe", 'ř': "r", 'ś': "s", 'š': "s", 'ß': "ss", 'ť': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+var slugSeparators = regexp.MustCompile(`-{2,}`)
+
+// Slugify turns a name into a safe ASCII branch name component
+// Accented letters are transliterated, other non-ASCII characters (e.g. emoji) are dropped
+// and characters git doesn't allow are replaced with hyphens.
+func Slugify(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r < 0x20 || r == 0x7f || strings.ContainsRune(refForbiddenChars, r):
+			b.WriteRune('-')
+		case r < 0x80:
+			b.WriteRune(r)
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		}
+	}
+
+	slug := strings.ReplaceAll(b.String(), "@{", "-")
+	for strings.Contains(slug, "..") {
+		slug = strings.ReplaceAll(slug, "..", ".")
+	}
+	slug = slugSeparators.ReplaceAllString(slug, "-")
+
+	var components []string
+	for _, c := range strings.Split(slug, "/") {
+		c = strings.TrimSuffix(c, ".lock")
+		c = strings.Trim(c, ".-")
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	return strings.Join(components, "/")
+}
+
+// NormalizeName trims a user-entered name and slugifies it if GW_BRANCH_SLUGIFY is set
+func NormalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	if enabled, _ := strconv.ParseBool(os.Getenv("GW_BRANCH_SLUGIFY")); enabled {
+		return Slugify(name)
+	}
+	return name
+}
+
 // Create creates a new branch
 func Create(branchName string) error {
 	cmd := exec.Command("git", "switch", "-c", branchName)
@@ -59,6 +182,38 @@ func Create(branchName string) error {
 	return cmd.Run()
 }
 
+// CreateFrom creates a new branch starting at base without checking it out
+// An empty base starts the branch at the current HEAD.
+func CreateFrom(branchName, base string) error {
+	args := []string{"branch", branchName}
+	if base != "" {
+		// Don't let a remote-tracking base become the upstream of the new branch
+		args = append(args, "--no-track", base)
+	}
+	cmd := exec.Command("git", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create branch: %w\n%s", err, string(output))
+	}
+	return nil
+}
+
+// Exists reports whether a local branch exists
+func Exists(branchName string) bool {
+	cmd := exec.Command("git", "show-ref", "--verify", "--quiet", "refs/heads/"+branchName)
+	return cmd.Run() == nil
+}
+
+// ListLocal returns the names of all local branches
+func ListLocal() ([]string, error) {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
 // GetCurrentBranch returns the current branch name
 func GetCurrentBranch() (string, error) {
 	cmd := exec.Command("git", "branch", "--show-current")
@@ -69,6 +224,21 @@ func GetCurrentBranch() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
+// CurrentRef returns the current branch, or the commit of HEAD if it is detached
+func CurrentRef() (string, error) {
+	current, err := GetCurrentBranch()
+	if err != nil || current != "" {
+		return current, err
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--verify", "HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // GetDefaultBranch returns the default branch name from git config
 func GetDefaultBranch() (string, error) {
 	cmd := exec.Command("git", "config", "--get", "init.defaultBranch")
@@ -79,3 +249,167 @@ func GetDefaultBranch() (string, error) {
 	}
 	return strings.TrimSpace(string(output)), nil
 }
+
+// ResolveBase returns the ref a new branch should start from
+// An explicit ref wins over GW_BASE. An empty result means the current HEAD.
+// Symbolic refs such as origin/HEAD are resolved to the branch they point to.
+func ResolveBase(ref string) (string, error) {
+	if ref == "" {
+		ref = os.Getenv("GW_BASE")
+	}
+	if ref == "" {
+		return "", nil
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("base ref %q does not exist", ref)
+	}
+
+	cmd = exec.Command("git", "rev-parse", "--abbrev-ref", ref)
+	output, err := cmd.Output()
+	if err != nil {
+		return ref, nil
+	}
+	// Commits and tags have no abbreviated branch name
+	if name := strings.TrimSpace(string(output)); name != "" && name != "HEAD" {
+		return name, nil
+	}
+	return ref, nil
+}
+
+// GetRemoteDefaultBranch returns the default branch of origin (e.g. origin/main)
+func GetRemoteDefaultBranch() (string, error) {
+	cmd := exec.Command("git", "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine the default branch of origin (try: git remote set-head origin --auto)")
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// FetchBase updates a remote-tracking base ref (e.g. origin/main) from its remote
+func FetchBase(base string) error {
+	// A ref that doesn't exist yet is taken as <remote>/<branch>
+	fullName := "refs/remotes/" + strings.TrimPrefix(strings.TrimPrefix(base, "refs/"), "remotes/")
+	cmd := exec.Command("git", "rev-parse", "--symbolic-full-name", base)
+	if output, err := cmd.Output(); err == nil {
+		if name := strings.TrimSpace(string(output)); name != "" {
+			fullName = name
+		}
+	}
+	if !strings.HasPrefix(fullName, "refs/remotes/") {
+		return fmt.Errorf("--fetch requires a remote-tracking base such as origin/main, got %q", base)
+	}
+
+	remotes, err := listRemotes()
+	if err != nil {
+		return err
+	}
+
+	// Remote names may contain slashes, so match against the configured remotes
+	rest := strings.TrimPrefix(fullName, "refs/remotes/")
+	for _, remote := range remotes {
+		if name, ok := strings.CutPrefix(rest, remote+"/"); ok {
+			cmd := exec.Command("git", "fetch", remote, name)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("failed to fetch %s: %w\n%s", base, err, string(output))
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no remote found for %s", base)
+}
+
+func listRemotes() ([]string, error) {
+	cmd := exec.Command("git", "remote")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// SetBase records the ref a branch was created from in branch.<name>.gwBase
+func SetBase(branchName, base string) error {
+	cmd := exec.Command("git", "config", "branch."+branchName+".gwBase", base)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to record base of %s: %w\n%s", branchName, err, string(output))
+	}
+	return nil
+}
+
+// GetBase returns the ref a branch was created from, or an empty string if unknown
+func GetBase(branchName string) string {
+	cmd := exec.Command("git", "config", "--get", "branch."+branchName+".gwBase")
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// SetDescription sets branch.<name>.description, which is also used by
+// `git branch --edit-description`. An empty description unsets it.
+func SetDescription(branchName, description string) error {
+	key := "branch." + branchName + ".description"
+	cmd := exec.Command("git", "config", key, description)
+	if description == "" {
+		cmd = exec.Command("git", "config", "--unset", key)
+	}
+	output, err := cmd.CombinedOutput()
+	// Exit code 5 means the key to unset didn't exist
+	if exitErr, ok := err.(*exec.ExitError); ok && description == "" && exitErr.ExitCode() == 5 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set description of %s: %w\n%s", branchName, err, string(output))
+	}
+	return nil
+}
+
+// GetDescription returns branch.<name>.description, or an empty string if not set
+func GetDescription(branchName string) string {
+	cmd := exec.Command("git", "config", "--get", "branch."+branchName+".description")
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// CommitsSinceBase returns the number of commits on a branch since its recorded base
+func CommitsSinceBase(branchName string) (int, error) {
+	base := GetBase(branchName)
+	if base == "" {
+		return 0, fmt.Errorf("no base recorded for %s", branchName)
+	}
+
+	cmd := exec.Command("git", "rev-list", "--count", base+".."+branchName)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count commits since %s: %w", base, err)
+	}
+
+	var count int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetDefaultRef returns a ref for the default branch: the local branch if it exists,
+// otherwise the default branch of origin. It returns an empty string if neither exists.
+func GetDefaultRef() string {
+	defaultBranch, err := GetDefaultBranch()
+	if err == nil && Exists(defaultBranch) {
+		return defaultBranch
+	}
+	if remote, err := GetRemoteDefaultBranch(); err == nil {
+		return remote
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package branch
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestCheckRefFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"feature", true},
+		{"user/2024/01/02/login", true},
+		{"fix-1.2", true},
+		{"a.lock.b", true},
+		{"日本語", true},
+		{"", false},
+		{"@", false},
+		{"HEAD", false},
+		{"-feature", false},
+		{"/feature", false},
+		{"feature/", false},
+		{"a//b", false},
+		{"feature.", false},
+		{"a..b", false},
+		{"a@{b", false},
+		{"feature.lock", false},
+		{"a/b.lock/c", false},
+		{".hidden", false},
+		{"a/.hidden", false},
+		{"a b", false},
+		{"a~b", false},
+		{"a^b", false},
+		{"a:b", false},
+		{"a?b", false},
+		{"a*b", false},
+		{"a[b", false},
+		{`a\b`, false},
+		{"a\tb", false},
+		{"a\nb", false},
+		{"a\x00b", false},
+		{"a\x7fb", false},
+	}
+
+	_, gitErr := exec.LookPath("git")
+	for _, tt := range tests {
+		err := checkRefFormat(tt.name)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("checkRefFormat(%q) = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+
+		// git can't receive NUL in an argument, and --branch expands "@" to the
+		// current branch
+		if gitErr != nil || tt.name == "a\x00b" || tt.name == "@" {
+			continue
+		}
+		gitValid := exec.Command("git", "check-ref-format", "--branch", tt.name).Run() == nil
+		if gitValid != tt.valid {
+			t.Errorf("git check-ref-format --branch %q: valid=%v, want %v", tt.name, gitValid, tt.valid)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Fix Login Bug", "fix-login-bug"},
+		{"Café résumé", "cafe-resume"},
+		{"straße", "strasse"},
+		{"ship it 🚀", "ship-it"},
+		{"what?*[now]", "what-now]"},
+		{"a..b", "a.b"},
+		{"a...b", "a.b"},
+		{"a@{1}", "a-1}"},
+		{"-leading", "leading"},
+		{"trailing.", "trailing"},
+		{"release.lock", "release"},
+		{"feat/.hidden", "feat/hidden"},
+		{"a//b/", "a/b"},
+		{"tab\there", "tab-here"},
+		{"line\nbreak", "line-break"},
+		{"back\\slash", "back-slash"},
+		{"🚀", ""},
+	}
+
+	for _, tt := range tests {
+		got := Slugify(tt.name)
+		if got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got != "" {
+			if err := checkRefFormat(got); err != nil {
+				t.Errorf("Slugify(%q) = %q, which is not a valid branch name: %v", tt.name, got, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package branch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// IsMerged reports whether all changes of ref are in target
+// Besides merges and fast-forwards (ref is an ancestor of target), this detects
+// squash and rebase merges: merging ref into target wouldn't change target's
+// tree, or the changes of ref squashed into one commit have the same patch-id
+// as a commit of target.
+func IsMerged(ref, target string) (bool, error) {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ref, target)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case !errors.As(err, &exitErr) || exitErr.ExitCode() != 1:
+		return false, fmt.Errorf("failed to compare %s with %s: %w", ref, target, err)
+	}
+
+	if mergeKeepsTree(ref, target) {
+		return true, nil
+	}
+	return squashApplied(ref, target), nil
+}
+
+// mergeKeepsTree reports whether merging ref into target results in target's tree
+// It needs git 2.38 or later; older versions report false.
+func mergeKeepsTree(ref, target string) bool {
+	output, err := exec.Command("git", "merge-tree", "--write-tree", target, ref).Output()
+	if err != nil {
+		return false
+	}
+	merged, _, _ := strings.Cut(string(output), "\n")
+
+	tree, err := revParse(target + "^{tree}")
+	return err == nil && merged == tree
+}
+
+// squashApplied reports whether the changes of ref since it forked from target,
+// squashed into one commit, were applied to target as a single commit
+func squashApplied(ref, target string) bool {
+	base, err := exec.Command("git", "merge-base", target, ref).Output()
+	if err != nil {
+		return false
+	}
+	tree, err := revParse(ref + "^{tree}")
+	if err != nil {
+		return false
+	}
+
+	// The squashed commit is only used for comparing and is never referenced,
+	// so the committer identity doesn't matter
+	cmd := exec.Command("git", "commit-tree", tree, "-p", strings.TrimSpace(string(base)), "-m", "squash")
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=gw", "GIT_AUTHOR_EMAIL=gw@localhost",
+		"GIT_COMMITTER_NAME=gw", "GIT_COMMITTER_EMAIL=gw@localhost",
+	)
+	squash, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+
+	// git cherry marks commits whose change is already in target with "-"
+	output, err := exec.Command("git", "cherry", target, strings.TrimSpace(string(squash))).Output()
+	return err == nil && strings.HasPrefix(string(output), "-")
+}
+
+// ListGone returns the local branches whose upstream no longer exists,
+// e.g. because it was deleted after the pull request was merged
+func ListGone() (map[string]bool, error) {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname:short)%00%(upstream:track)", "refs/heads")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %w", err)
+	}
+
+	gone := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if name, track, ok := strings.Cut(line, "\x00"); ok && track == "[gone]" {
+			gone[name] = true
+		}
+	}
+	return gone, nil
+}
+
+// StartCommit returns the commit a branch pointed to when it was created,
+// according to its reflog, or an empty string if the reflog doesn't go back that far
+func StartCommit(branchName string) string {
+	output, err := exec.Command("git", "reflog", "show", "--format=%H %gs", "refs/heads/"+branchName, "--").Output()
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	commit, subject, _ := strings.Cut(lines[len(lines)-1], " ")
+	if !strings.HasPrefix(subject, "branch: Created from") {
+		return ""
+	}
+	return commit
+}
+
+func revParse(rev string) (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--verify", "--quiet", rev).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
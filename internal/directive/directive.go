@@ -0,0 +1,62 @@
+package directive
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/qawatake/gw/internal/shell"
+)
+
+// envName matches the names setenv accepts
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Available reports whether a shell wrapper is there to carry out directives
+func Available() bool {
+	return os.Getenv("GW_DIRECTIVE_FILE") != ""
+}
+
+// CD asks the shell to change its directory to dir
+func CD(dir string) error {
+	switch os.Getenv("GW_SHELL") {
+	case "fish":
+		return emit("cd " + shell.QuoteFish(dir))
+	default:
+		return emit("cd -- " + shell.Quote(dir))
+	}
+}
+
+// Setenv asks the shell to export an environment variable
+func Setenv(name, value string) error {
+	if !envName.MatchString(name) {
+		return fmt.Errorf("invalid environment variable name %q", name)
+	}
+	switch os.Getenv("GW_SHELL") {
+	case "fish":
+		return emit("set -gx " + name + " " + shell.QuoteFish(value))
+	default:
+		return emit("export " + name + "=" + shell.Quote(value))
+	}
+}
+
+// emit hands a shell command to the shell wrapper
+// The wrapper passes a file in GW_DIRECTIVE_FILE and its shell in GW_SHELL, and
+// sources the file after every gw command, so directives never mix with the
+// output of commands. Without the wrapper, the command is printed on stdout.
+func emit(line string) error {
+	path := os.Getenv("GW_DIRECTIVE_FILE")
+	if path == "" {
+		fmt.Println(line)
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open directive file: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("failed to write directive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Hook names
+const (
+	PreAdd  = "pre-add"
+	PostAdd = "post-add"
+	PreRm   = "pre-rm"
+	PostRm  = "post-rm"
+	PostCD  = "post-cd"
+)
+
+const repoHooksDir = ".gw/hooks"
+const rootHooksDirName = ".gw-hooks"
+
+// Env describes the worktree a hook runs for
+type Env struct {
+	Path         string // worktree path
+	Branch       string // branch name
+	Repo         string // repository name
+	Root         string // per-repo worktree root (e.g. ~/.worktrees/{repo})
+	MainWorktree string // path of the main worktree
+}
+
+// Dirs returns the directories searched for hooks, in execution order
+// Format: {main worktree}/.gw/hooks/ and ~/.worktrees/{repo}/.gw-hooks/
+func Dirs(env Env) []string {
+	var dirs []string
+	if env.MainWorktree != "" {
+		dirs = append(dirs, filepath.Join(env.MainWorktree, repoHooksDir))
+	}
+	if env.Root != "" {
+		dirs = append(dirs, filepath.Join(env.Root, rootHooksDirName))
+	}
+	return dirs
+}
+
+// Run runs the executables named name found in the hook directories
+// It stops at the first failing hook and returns its error.
+// Hook output goes to stderr so that stdout stays clean for the shell wrapper and scripts.
+func Run(name string, env Env) error {
+	for _, dir := range Dirs(env) {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if info.Mode()&0111 == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: hook %s is not executable, skipped\n", path)
+			continue
+		}
+
+		cmd := exec.Command(path)
+		cmd.Dir = workDir(env)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"GW_HOOK="+name,
+			"GW_WORKTREE_PATH="+env.Path,
+			"GW_BRANCH="+env.Branch,
+			"GW_REPO="+env.Repo,
+			"GW_ROOT="+env.Root,
+			"GW_MAIN_WORKTREE="+env.MainWorktree,
+		)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook failed (%s): %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+// workDir returns the worktree if it exists (it doesn't yet for pre-add
+// and no longer does for post-rm), falling back to the main worktree
+func workDir(env Env) string {
+	if info, err := os.Stat(env.Path); err == nil && info.IsDir() {
+		return env.Path
+	}
+	return env.MainWorktree
+}
@@ -336,19 +336,21 @@ func Pull(worktreeRoot string) ([]PullResult, error) {
 }
 
 // CreateSymlinks creates symlinks in a worktree for all items in .gw-links
-func CreateSymlinks(worktreePath string, worktreeRoot string) []string {
+// Items that already exist in the worktree are skipped with a warning;
+// any other failure is returned as an error.
+func CreateSymlinks(worktreePath string, worktreeRoot string) ([]string, error) {
 	linksDir := GetLinksDir(worktreeRoot)
 	var warnings []string
 
 	// Check if .gw-links exists
 	if _, err := os.Stat(linksDir); os.IsNotExist(err) {
-		return nil
+		return nil, nil
 	}
 
 	// Walk through .gw-links and create symlinks
-	filepath.WalkDir(linksDir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(linksDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return nil // Continue on error
+			return err
 		}
 
 		if path == linksDir {
@@ -358,14 +360,16 @@ func CreateSymlinks(worktreePath string, worktreeRoot string) []string {
 		// Get relative path from .gw-links
 		relPath, err := filepath.Rel(linksDir, path)
 		if err != nil {
-			return nil
+			return err
 		}
 
 		destPath := filepath.Join(worktreePath, relPath)
 
 		if d.IsDir() {
 			// Create directory structure
-			os.MkdirAll(destPath, 0755)
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %s: %w", relPath, err)
+			}
 		} else {
 			// Check if file already exists
 			if _, err := os.Lstat(destPath); err == nil {
@@ -374,16 +378,18 @@ func CreateSymlinks(worktreePath string, worktreeRoot string) []string {
 			}
 
 			// Ensure parent directory exists
-			os.MkdirAll(filepath.Dir(destPath), 0755)
+			if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %s: %w", relPath, err)
+			}
 
 			// Create symlink
 			if err := os.Symlink(path, destPath); err != nil {
-				warnings = append(warnings, fmt.Sprintf("failed to create symlink: %s: %v", relPath, err))
+				return fmt.Errorf("failed to create symlink: %s: %w", relPath, err)
 			}
 		}
 
 		return nil
 	})
 
-	return warnings
+	return warnings, err
 }
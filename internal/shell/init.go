@@ -32,29 +32,57 @@ func detectShell() string {
 	return filepath.Base(shell)
 }
 
+// getBashZshInit returns the wrapper for bash and zsh
+// The wrapper passes a fresh directive file to every gw command and sources
+// it afterwards, so that gw can change the directory or environment of the shell.
+// Like the fish wrapper, it also records every directory change with the hidden
+// "gw __visit" command so that cds done outside gw are part of the navigation
+// history (PROMPT_COMMAND in bash, chpwd in zsh, PWD changes in fish).
 func getBashZshInit(gwPath string) string {
 	return fmt.Sprintf(`gw() {
-  local output
-  if [ "$1" = "cd" ]; then
-    output=$(%s cd "${@:2}")
-    if [ $? -eq 0 ] && [ -n "$output" ]; then
-      eval "$output"
-    fi
-  else
-    %s "$@"
+  local directive gw_status gw_shell=bash
+  [ -n "${ZSH_VERSION-}" ] && gw_shell=zsh
+  directive=$(mktemp "${TMPDIR:-/tmp}/gw.XXXXXX") || return
+  GW_DIRECTIVE_FILE="$directive" GW_SHELL="$gw_shell" %[1]s "$@"
+  gw_status=$?
+  if [ -s "$directive" ]; then
+    . "$directive"
   fi
-}`, gwPath, gwPath)
+  rm -f "$directive"
+  return $gw_status
+}
+
+__gw_visit() {
+  if [ "$PWD" != "${__gw_last_pwd-}" ]; then
+    __gw_last_pwd=$PWD
+    %[1]s __visit >/dev/null 2>&1
+  fi
+}
+
+if [ -n "${ZSH_VERSION-}" ]; then
+  autoload -Uz add-zsh-hook
+  add-zsh-hook chpwd __gw_visit
+else
+  case ";${PROMPT_COMMAND-};" in
+    *";__gw_visit;"*) ;;
+    *) PROMPT_COMMAND="__gw_visit${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+  esac
+fi`, Quote(gwPath))
 }
 
 func getFishInit(gwPath string) string {
 	return fmt.Sprintf(`function gw
-  if test "$argv[1]" = "cd"
-    set output (%s cd $argv[2..-1])
-    if test $status -eq 0; and test -n "$output"
-      eval "$output"
-    end
-  else
-    %s $argv
+  set -l directive (mktemp -t gw.XXXXXX); or return
+  GW_DIRECTIVE_FILE=$directive GW_SHELL=fish %[1]s $argv
+  set -l gw_status $status
+  if test -s $directive
+    source $directive
   end
-end`, gwPath, gwPath)
+  rm -f $directive
+  return $gw_status
+end
+
+function __gw_visit --on-variable PWD
+  %[1]s __visit >/dev/null 2>&1
+end`, QuoteFish(gwPath))
 }
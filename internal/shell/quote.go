@@ -0,0 +1,14 @@
+package shell
+
+import "strings"
+
+// Quote quotes s as a single word for POSIX shells
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteFish quotes s as a single word for fish
+// In fish, backslashes are also special inside single quotes.
+func QuoteFish(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,128 @@
+package shell
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// quoteInputs are words that are special to POSIX shells or fish
+var quoteInputs = []string{
+	"",
+	"plain",
+	"/path/with spaces/gw",
+	"$HOME",
+	"${HOME}",
+	"`id`",
+	"$(id)",
+	"it's",
+	"''",
+	`back\slash`,
+	`trailing\`,
+	`\'`,
+	`"double"`,
+	"semi;colon && pipe | amp &",
+	"glob * ? [a]",
+	"tilde ~ # hash",
+	"new\nline",
+	"tab\there",
+	"日本語",
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", `'plain'`},
+		{"", `''`},
+		{"it's", `'it'\''s'`},
+		{`back\slash`, `'back\slash'`},
+		{"$HOME `id`", "'$HOME `id`'"},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestQuoteRoundTrip checks that sh reads each quoted word back unchanged
+func TestQuoteRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	for _, in := range quoteInputs {
+		output, err := exec.Command("sh", "-c", "printf '%s' "+Quote(in)).Output()
+		if err != nil {
+			t.Fatalf("sh -c with Quote(%q): %v", in, err)
+		}
+		if got := string(output); got != in {
+			t.Errorf("sh read Quote(%q) = %s back as %q", in, Quote(in), got)
+		}
+	}
+}
+
+func TestQuoteFish(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", `'plain'`},
+		{"", `''`},
+		{"it's", `'it\'s'`},
+		{`back\slash`, `'back\\slash'`},
+		{`trailing\`, `'trailing\\'`},
+		{"$HOME `id`", "'$HOME `id`'"},
+	}
+	for _, tt := range tests {
+		if got := QuoteFish(tt.in); got != tt.want {
+			t.Errorf("QuoteFish(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestQuoteFishRoundTrip checks each quoted word against fish's rules for single
+// quotes, and against fish itself if it is installed
+func TestQuoteFishRoundTrip(t *testing.T) {
+	_, fishErr := exec.LookPath("fish")
+	for _, in := range quoteInputs {
+		quoted := QuoteFish(in)
+		if got, ok := unquoteFish(quoted); !ok || got != in {
+			t.Errorf("QuoteFish(%q) = %s reads back as %q (ok=%v)", in, quoted, got, ok)
+		}
+
+		if fishErr != nil {
+			continue
+		}
+		output, err := exec.Command("fish", "--no-config", "-c", "printf '%s' "+quoted).Output()
+		if err != nil {
+			t.Fatalf("fish -c with QuoteFish(%q): %v", in, err)
+		}
+		if got := string(output); got != in {
+			t.Errorf("fish read QuoteFish(%q) = %s back as %q", in, quoted, got)
+		}
+	}
+}
+
+// unquoteFish parses a word made of one single-quoted string the way fish does:
+// inside single quotes only \\ and \' are escapes, and any other backslash is literal
+func unquoteFish(word string) (string, bool) {
+	if len(word) < 2 || word[0] != '\'' {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(word); i++ {
+		switch c := word[i]; {
+		case c == '\'':
+			// The closing quote must end the word
+			return b.String(), i == len(word)-1
+		case c == '\\' && i+1 < len(word) && (word[i+1] == '\\' || word[i+1] == '\''):
+			b.WriteByte(word[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,155 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/qawatake/gw/internal/worktree"
+)
+
+// fileName is the name of the metadata file kept in the per-repo worktree root
+const fileName = ".gw-state.json"
+
+// historySize is the number of visits kept in the navigation history
+const historySize = 100
+
+// Entry is what gw remembers about a worktree
+type Entry struct {
+	Created time.Time `json:"created,omitzero"`
+	Visited time.Time `json:"visited,omitzero"`
+	Visits  int       `json:"visits,omitempty"`
+}
+
+// Store is the per-repo metadata store, keyed by worktree path
+type Store struct {
+	path      string
+	Worktrees map[string]*Entry `json:"worktrees"`
+	// History is the paths of the visited worktrees, oldest first
+	History []string `json:"history,omitempty"`
+}
+
+// Load reads the store of the repository whose worktree root is rootDir
+// A missing or unreadable file gives an empty store.
+func Load(rootDir string) (*Store, error) {
+	s := &Store{
+		path:      filepath.Join(rootDir, fileName),
+		Worktrees: make(map[string]*Entry),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return s, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	if s.Worktrees == nil {
+		s.Worktrees = make(map[string]*Entry)
+	}
+	return s, nil
+}
+
+// Save writes the store atomically so that concurrent readers never see a partial file
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(s.path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), fileName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// Update loads the store, applies fn and saves it
+func Update(rootDir string, fn func(s *Store)) error {
+	s, err := Load(rootDir)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	return s.Save()
+}
+
+func (s *Store) entry(path string) *Entry {
+	e, ok := s.Worktrees[path]
+	if !ok {
+		e = &Entry{}
+		s.Worktrees[path] = e
+	}
+	return e
+}
+
+// RecordCreated records that the worktree at path was created now
+func (s *Store) RecordCreated(path string) {
+	s.entry(path).Created = time.Now()
+}
+
+// RecordVisit records that the worktree at path was visited now
+// Moving around inside the worktree visited last doesn't count as another visit.
+func (s *Store) RecordVisit(path string) {
+	e := s.entry(path)
+	e.Visited = time.Now()
+	if len(s.History) > 0 && s.History[len(s.History)-1] == path {
+		return
+	}
+	e.Visits++
+	s.History = append(s.History, path)
+	if len(s.History) > historySize {
+		s.History = s.History[len(s.History)-historySize:]
+	}
+}
+
+// Forget drops what is known about the worktree at path
+func (s *Store) Forget(path string) {
+	delete(s.Worktrees, path)
+	s.History = slices.DeleteFunc(s.History, func(p string) bool { return p == path })
+}
+
+// Recent returns the paths of the visited worktrees, most recently visited first, without duplicates
+func (s *Store) Recent() []string {
+	var recent []string
+	seen := make(map[string]bool)
+	for _, path := range slices.Backward(s.History) {
+		if !seen[path] {
+			seen[path] = true
+			recent = append(recent, path)
+		}
+	}
+	return recent
+}
+
+// Apply copies the recorded times into worktrees
+func (s *Store) Apply(worktrees []worktree.Worktree) {
+	for i := range worktrees {
+		if e, ok := s.Worktrees[worktrees[i].Path]; ok {
+			worktrees[i].Created = e.Created
+			worktrees[i].Visited = e.Visited
+			worktrees[i].Visits = e.Visits
+		}
+	}
+}
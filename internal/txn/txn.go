@@ -0,0 +1,116 @@
+package txn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+// ErrInterrupted is returned when a transaction is interrupted by a signal
+var ErrInterrupted = errors.New("interrupted")
+
+// Step is a single undoable operation
+type Step struct {
+	Name string
+	Do   func() error
+	// Undo reverts Do. It is only called if Do succeeded; nil means nothing to undo.
+	Undo func() error
+}
+
+// Run executes steps in order
+// If a step fails or SIGINT/SIGTERM is received, the steps already done are
+// undone in reverse order so that the repository is back where it started.
+func Run(steps []Step) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	var done []Step
+	for _, step := range steps {
+		if interrupted(sigCh) {
+			return rollback(done, ErrInterrupted)
+		}
+
+		if err := step.Do(); err != nil {
+			// A signal during the step usually is the cause of its failure
+			if interrupted(sigCh) {
+				err = ErrInterrupted
+			}
+			return rollback(done, fmt.Errorf("%s: %w", step.Name, err))
+		}
+		done = append(done, step)
+	}
+
+	// Don't leave a half-finished operation behind if the signal arrived during the last step
+	if interrupted(sigCh) {
+		return rollback(done, ErrInterrupted)
+	}
+
+	return nil
+}
+
+func interrupted(sigCh <-chan os.Signal) bool {
+	select {
+	case <-sigCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// rollback undoes the done steps in reverse order and returns cause
+// together with any errors from undoing
+func rollback(done []Step, cause error) error {
+	errs := []error{cause}
+	for i := len(done) - 1; i >= 0; i-- {
+		step := done[i]
+		if step.Undo == nil {
+			continue
+		}
+		if err := step.Undo(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to undo %s: %w", step.Name, err))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Rolled back: %s\n", step.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// MkdirAll returns a step that creates dir and its parents
+// Undo removes only the directories that the step created.
+func MkdirAll(name, dir string) Step {
+	var created string
+	return Step{
+		Name: name,
+		Do: func() error {
+			created = firstMissing(dir)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", dir, err)
+			}
+			return nil
+		},
+		Undo: func() error {
+			if created == "" {
+				return nil
+			}
+			return os.RemoveAll(created)
+		},
+	}
+}
+
+// firstMissing returns the topmost ancestor of dir (or dir itself) that doesn't exist yet
+func firstMissing(dir string) string {
+	missing := ""
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			return missing
+		}
+		missing = d
+		if filepath.Dir(d) == d {
+			return missing
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package ui
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/qawatake/gw/internal/shell"
+)
+
+// Keys read from the terminal in raw mode
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlJ     = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEsc       = 27
+	keyDelete    = 127
+)
+
+// builtinSelector is gw's own selector, drawn in the terminal
+// In multiple selection, Space or Tab marks an item; Enter returns the marked
+// items, or the item under the cursor if none is marked.
+type builtinSelector struct{}
+
+func (builtinSelector) Select(items []string, opts SelectOptions) (string, error) {
+	selected, err := runBuiltin(items, opts, false)
+	if err != nil {
+		return "", err
+	}
+	return selected[0], nil
+}
+
+func (builtinSelector) MultiSelect(items []string, opts SelectOptions) ([]string, error) {
+	if opts.Prompt == "" {
+		opts.Prompt = "Select (Space to mark, Enter to confirm)> "
+	}
+	return runBuiltin(items, opts, true)
+}
+
+// builtinView is the state of the built-in selector
+type builtinView struct {
+	items    []string
+	query    []rune
+	prompt   string
+	multi    bool
+	matches  []int // indexes of the items matching the query, best first
+	cursor   int   // index into matches
+	offset   int   // first visible match
+	selected map[int]bool
+	preview  string           // preview command, "{}" is replaced by the item
+	previews map[int][]string // preview output by item index
+}
+
+// minPreviewCols is the terminal width from which the preview pane is shown
+const minPreviewCols = 80
+
+func runBuiltin(items []string, opts SelectOptions, multi bool) ([]string, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items to select")
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TTY: %w", err)
+	}
+	defer tty.Close()
+
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	// Draw on the alternate screen so that the terminal is left as it was
+	fmt.Fprint(tty, "\x1b[?1049h")
+	defer fmt.Fprint(tty, "\x1b[?1049l")
+
+	s := &builtinView{
+		items:    items,
+		query:    []rune(opts.Query),
+		prompt:   cmp.Or(opts.Prompt, "> "),
+		multi:    multi,
+		selected: make(map[int]bool),
+		preview:  opts.Preview,
+		previews: make(map[int][]string),
+	}
+	s.filter()
+
+	keys := &keyReader{tty: tty}
+	for {
+		rows, cols := terminalSize(tty)
+		s.render(tty, rows, cols)
+
+		key, seq, err := keys.next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from TTY: %w", err)
+		}
+		done, err := s.handle(key, seq, rows)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return s.result()
+		}
+	}
+}
+
+// handle applies a key (with the rest of its escape sequence) and reports whether the selection is done
+func (s *builtinView) handle(key rune, seq string, rows int) (bool, error) {
+	switch key {
+	case keyCtrlC, keyCtrlG:
+		return false, ErrCancelled
+	case keyCtrlD:
+		if len(s.query) == 0 {
+			return false, ErrCancelled
+		}
+	case keyEsc:
+		switch seq {
+		case "":
+			return false, ErrCancelled
+		case "[A", "OA":
+			s.move(-1)
+		case "[B", "OB":
+			s.move(1)
+		case "[5~":
+			s.move(-max(rows-2, 1))
+		case "[6~":
+			s.move(max(rows-2, 1))
+		}
+	case keyEnter, keyCtrlJ:
+		return len(s.matches) > 0 || len(s.selected) > 0, nil
+	case keyCtrlP, keyCtrlK:
+		s.move(-1)
+	case keyCtrlN:
+		s.move(1)
+	case keyBackspace, keyDelete:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+			s.filter()
+		}
+	case keyCtrlU:
+		s.query = s.query[:0]
+		s.filter()
+	case keyCtrlW:
+		q := strings.TrimRightFunc(string(s.query), unicode.IsSpace)
+		q = q[:strings.LastIndexFunc(q, unicode.IsSpace)+1]
+		s.query = []rune(q)
+		s.filter()
+	case ' ', keyTab:
+		if s.multi {
+			if len(s.matches) > 0 {
+				i := s.matches[s.cursor]
+				if s.selected[i] {
+					delete(s.selected, i)
+				} else {
+					s.selected[i] = true
+				}
+				s.move(1)
+			}
+			break
+		}
+		if key == ' ' {
+			s.query = append(s.query, key)
+			s.filter()
+		}
+	default:
+		if unicode.IsPrint(key) {
+			s.query = append(s.query, key)
+			s.filter()
+		}
+	}
+	return false, nil
+}
+
+// result returns the marked items in their original order, or the item under the cursor
+func (s *builtinView) result() ([]string, error) {
+	if len(s.selected) == 0 {
+		return []string{s.items[s.matches[s.cursor]]}, nil
+	}
+	var result []string
+	for i, item := range s.items {
+		if s.selected[i] {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (s *builtinView) move(delta int) {
+	if len(s.matches) == 0 {
+		return
+	}
+	s.cursor = min(max(s.cursor+delta, 0), len(s.matches)-1)
+}
+
+// filter updates the matches for the current query
+func (s *builtinView) filter() {
+	terms := strings.Fields(string(s.query))
+
+	type match struct {
+		index int
+		score int
+	}
+	var matches []match
+	for i, item := range s.items {
+		total := 0
+		ok := true
+		for _, term := range terms {
+			score, found := fuzzyMatch(item, term)
+			if !found {
+				ok = false
+				break
+			}
+			total += score
+		}
+		if ok {
+			matches = append(matches, match{index: i, score: total})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int { return a.score - b.score })
+
+	s.matches = s.matches[:0]
+	for _, m := range matches {
+		s.matches = append(s.matches, m.index)
+	}
+	s.cursor = 0
+	s.offset = 0
+}
+
+// fuzzyMatch reports whether the runes of term appear in item in order and
+// scores the match by the length of the shortest span containing them (lower is better)
+// The match ignores case unless term contains an upper case letter.
+func fuzzyMatch(item, term string) (int, bool) {
+	if !strings.ContainsFunc(term, unicode.IsUpper) {
+		item = strings.ToLower(item)
+	}
+	text := []rune(item)
+	pattern := []rune(term)
+
+	best := -1
+	for start := range text {
+		if text[start] != pattern[0] {
+			continue
+		}
+		j := 1
+		end := start + 1
+		for ; end < len(text) && j < len(pattern); end++ {
+			if text[end] == pattern[j] {
+				j++
+			}
+		}
+		if j < len(pattern) {
+			// No later start can match either
+			break
+		}
+		if span := end - start; best < 0 || span < best {
+			best = span
+		}
+	}
+	return best, best >= 0
+}
+
+// render draws the prompt, the match count and the visible matches
+func (s *builtinView) render(tty *os.File, rows, cols int) {
+	height := max(rows-2, 1)
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if s.cursor >= s.offset+height {
+		s.offset = s.cursor - height + 1
+	}
+
+	// The preview takes the right half of the screen
+	listCols := cols
+	if s.preview != "" && cols >= minPreviewCols {
+		listCols = cols / 2
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	b.WriteString(truncate(s.prompt+string(s.query), listCols))
+
+	status := fmt.Sprintf("  %d/%d", len(s.matches), len(s.items))
+	if s.multi {
+		status += fmt.Sprintf(" (%d selected)", len(s.selected))
+	}
+	b.WriteString("\r\n\x1b[2m" + truncate(status, listCols) + "\x1b[0m")
+
+	for n := s.offset; n < len(s.matches) && n < s.offset+height; n++ {
+		i := s.matches[n]
+		mark := "  "
+		if s.selected[i] {
+			mark = "* "
+		}
+		line := truncate(mark+s.items[i], listCols)
+		if n == s.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString("\r\n" + line)
+	}
+
+	if listCols < cols && len(s.matches) > 0 {
+		lines := s.previewLines(s.matches[s.cursor])
+		for row := 1; row <= rows; row++ {
+			var line string
+			if row <= len(lines) {
+				line = truncate(lines[row-1], cols-listCols-2)
+			}
+			fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[2m│\x1b[0m %s", row, listCols+1, line)
+		}
+	}
+
+	// Leave the cursor at the end of the query
+	fmt.Fprintf(&b, "\x1b[1;%dH", min(utf8.RuneCountInString(s.prompt)+len(s.query)+1, listCols))
+	fmt.Fprint(tty, b.String())
+}
+
+// ansiEscape matches the terminal escape sequences a preview command may print
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// previewLines returns the output of the preview command for an item, running it once per item
+func (s *builtinView) previewLines(i int) []string {
+	if lines, ok := s.previews[i]; ok {
+		return lines
+	}
+
+	command := strings.ReplaceAll(s.preview, "{}", shell.Quote(s.items[i]))
+	output, _ := exec.Command("sh", "-c", command).CombinedOutput()
+	text := ansiEscape.ReplaceAllString(string(output), "")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for j, line := range lines {
+		lines[j] = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	s.previews[i] = lines
+	return lines
+}
+
+// truncate shortens s to at most width runes
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:max(width, 0)])
+}
+
+// keyReader reads keys from a terminal in raw mode
+// Terminals write an escape sequence such as "\x1b[A" for the up arrow at once,
+// so an ESC that is the last byte read is the Esc key itself.
+type keyReader struct {
+	tty *os.File
+	buf []byte
+}
+
+// next returns the next key, and the rest of the escape sequence if the key is ESC
+func (r *keyReader) next() (rune, string, error) {
+	if len(r.buf) == 0 {
+		b := make([]byte, 256)
+		n, err := r.tty.Read(b)
+		if err != nil {
+			return 0, "", err
+		}
+		r.buf = b[:n]
+	}
+
+	if r.buf[0] != keyEsc {
+		key, size := utf8.DecodeRune(r.buf)
+		r.buf = r.buf[size:]
+		return key, "", nil
+	}
+
+	// Sequences end with a letter or "~" after their "[" or "O" introducer
+	end := 1
+	for end < len(r.buf) {
+		c := r.buf[end]
+		end++
+		if end > 2 && (c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '~') {
+			break
+		}
+	}
+	seq := string(r.buf[1:end])
+	r.buf = r.buf[end:]
+	return keyEsc, seq, nil
+}
+
+// makeRaw puts the terminal into raw mode and returns a function restoring it
+func makeRaw(tty *os.File) (func(), error) {
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terminal state: %w", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("failed to set raw mode: %w", err)
+	}
+	return func() {
+		stty(tty, strings.TrimSpace(saved))
+	}, nil
+}
+
+// stty runs stty on the terminal
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// terminalSize returns the number of rows and columns of the terminal
+func terminalSize(tty *os.File) (int, int) {
+	output, err := stty(tty, "size")
+	if err != nil {
+		return 24, 80
+	}
+	var rows, cols int
+	if _, err := fmt.Sscanf(output, "%d %d", &rows, &cols); err != nil || rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
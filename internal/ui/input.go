@@ -1,13 +1,16 @@
 package ui
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 // ErrCancelled is returned when user cancels the selection
@@ -15,6 +18,7 @@ var ErrCancelled = errors.New("selection cancelled")
 
 // EditWithEditor opens an editor to get user input
 // Similar to vcat command
+// It returns the edited buffer without "#" comment lines and trailing whitespace.
 func EditWithEditor(initialContent string) (string, error) {
 	// Create temporary file
 	tmpfile, err := os.CreateTemp("", "gw-*.txt")
@@ -31,23 +35,8 @@ func EditWithEditor(initialContent string) (string, error) {
 	}
 	tmpfile.Close()
 
-	// Get editor
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = os.Getenv("GW_EDITOR")
-	}
-	if editor == "" {
-		editor = "vim"
-	}
-
-	// Open editor
-	cmd := exec.Command(editor, tmpfile.Name())
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to run editor: %w", err)
+	if err := OpenInEditor(tmpfile.Name()); err != nil {
+		return "", err
 	}
 
 	// Read edited content
@@ -56,207 +45,126 @@ func EditWithEditor(initialContent string) (string, error) {
 		return "", fmt.Errorf("failed to read temp file: %w", err)
 	}
 
-	// Get first line and trim whitespace
-	lines := strings.Split(string(content), "\n")
-	if len(lines) == 0 {
-		return "", nil
+	// Drop comment lines
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
 	}
-
-	result := strings.TrimSpace(lines[0])
-	return result, nil
+	return strings.TrimRightFunc(strings.Join(lines, "\n"), unicode.IsSpace), nil
 }
 
-// SelectWithPeco opens peco for interactive selection
-func SelectWithPeco(items []string) (string, error) {
-	if len(items) == 0 {
-		return "", fmt.Errorf("no items to select")
-	}
-
-	cmd := exec.Command("peco", "--on-cancel=error")
-
-	// Connect to TTY for interactive mode
-	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
-	if err != nil {
-		return "", fmt.Errorf("failed to open TTY: %w", err)
-	}
-	defer tty.Close()
-
-	// Set up pipes before starting
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to create stdin pipe: %w", err)
+// OpenInEditor opens a file in the user's editor and waits for it to exit
+func OpenInEditor(path string) error {
+	// Get editor
+	editor := os.Getenv("GW_EDITOR")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
 	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to create stdout pipe: %w", err)
+	if editor == "" {
+		editor = "vim"
 	}
 
-	// peco displays UI on stderr and reads keyboard input from TTY
-	cmd.Stderr = tty
-
-	// Start peco
-	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start peco: %w", err)
-	}
+	// Open editor
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
-	// Write items to stdin
-	go func() {
-		defer stdin.Close()
-		for _, item := range items {
-			fmt.Fprintln(stdin, item)
+	// stdin may be a pipe (prefilled content) and stdout may be captured
+	// (e.g. --print-path), so talk to the terminal directly in that case
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open TTY: %w", err)
 		}
-	}()
-
-	// Read stdout
-	output, err := io.ReadAll(stdout)
-	if err != nil {
-		return "", fmt.Errorf("failed to read output: %w", err)
+		defer tty.Close()
+		cmd.Stdin = tty
+		cmd.Stdout = tty
 	}
 
-	// Wait for peco to finish
-	waitErr := cmd.Wait()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run editor: %w", err)
+	}
+	return nil
+}
 
-	if waitErr != nil {
-		// exit code 1 = cancelled (--on-cancel=error)
-		if exitErr, ok := waitErr.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return "", ErrCancelled
+// CommentLines formats a message as "#" comment lines for an editor buffer
+// Comment lines are ignored when the buffer is read back, like in git commit.
+func CommentLines(message string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		if line == "" {
+			b.WriteString("#\n")
+			continue
 		}
-		return "", fmt.Errorf("peco failed: %w", waitErr)
+		b.WriteString("# " + line + "\n")
 	}
-
-	result := strings.TrimSpace(string(output))
-	return result, nil
+	return b.String()
 }
 
-// MultiSelect opens an interactive multi-select UI
-// Prefers fzf, falls back to peco if fzf is not available
-func MultiSelect(items []string) ([]string, error) {
-	if len(items) == 0 {
-		return nil, fmt.Errorf("no items to select")
+// ReadStdin returns the content piped to stdin
+// It returns an empty string without reading if stdin is a terminal
+func ReadStdin() (string, error) {
+	if isTerminal(os.Stdin) {
+		return "", nil
 	}
-
-	// Check if fzf is available
-	if _, err := exec.LookPath("fzf"); err == nil {
-		return multiSelectWithFzf(items)
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
 	}
-
-	// Fallback to peco (single select repeated)
-	return multiSelectWithPeco(items)
+	return string(content), nil
 }
 
-// multiSelectWithFzf uses fzf for multi-select
-func multiSelectWithFzf(items []string) ([]string, error) {
-	cmd := exec.Command("fzf", "--multi", "--prompt=Select worktrees to remove (Space to select, Enter to confirm): ")
-
-	// Connect to TTY for interactive mode
+// HasTTY reports whether a controlling terminal is available for interactive input
+func HasTTY() bool {
 	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open TTY: %w", err)
+		return false
 	}
-	defer tty.Close()
+	tty.Close()
+	return true
+}
 
-	// Set up pipes
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+// TerminalWidth returns the width of the terminal, or 120 if it can't be determined
+func TerminalWidth() int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
 	}
 
-	stdout, err := cmd.StdoutPipe()
+	tty, err := os.Open("/dev/tty")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
-
-	// fzf displays UI on stderr and reads keyboard input from TTY
-	cmd.Stderr = tty
-
-	// Start fzf
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start fzf: %w", err)
+		return 120
 	}
+	defer tty.Close()
 
-	// Write items to stdin
-	go func() {
-		defer stdin.Close()
-		for _, item := range items {
-			fmt.Fprintln(stdin, item)
-		}
-	}()
-
-	// Read stdout
-	output, err := io.ReadAll(stdout)
+	// stty reports the size of the terminal connected to its stdin
+	output, err := stty(tty, "size")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read output: %w", err)
-	}
-
-	// Wait for fzf to finish
-	waitErr := cmd.Wait()
-
-	if waitErr != nil {
-		// exit code 1 = ESC, exit code 130 = Ctrl+C
-		if exitErr, ok := waitErr.(*exec.ExitError); ok {
-			if exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130 {
-				return nil, ErrCancelled
-			}
-		}
-		return nil, fmt.Errorf("fzf failed: %w", waitErr)
+		return 120
 	}
-
-	// Parse selected items
-	selected := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(selected) == 1 && selected[0] == "" {
-		return []string{}, nil
+	var rows, cols int
+	if _, err := fmt.Sscanf(output, "%d %d", &rows, &cols); err != nil || cols <= 0 {
+		return 120
 	}
-
-	return selected, nil
+	return cols
 }
 
-// multiSelectWithPeco uses peco for single selection (repeated until done)
-func multiSelectWithPeco(items []string) ([]string, error) {
-	const doneMarker = "*** Done - Finish selection ***"
-	var selected []string
-	remaining := make([]string, len(items))
-	copy(remaining, items)
-
-	for {
-		if len(remaining) == 0 {
-			break
-		}
-
-		// Add "Done" option to the list
-		choices := make([]string, 0, len(remaining)+1)
-		choices = append(choices, doneMarker)
-		choices = append(choices, remaining...)
-
-		choice, err := SelectWithPeco(choices)
-		if err != nil {
-			// Check if user cancelled with Ctrl+C
-			if errors.Is(err, ErrCancelled) {
-				return nil, ErrCancelled
-			}
-			// Other errors
-			return nil, err
-		}
-
-		// Check if user selected "Done"
-		if choice == doneMarker {
-			break
-		}
-
-		// Add to selected
-		selected = append(selected, choice)
+// ColorEnabled reports whether stdout is a terminal that should get colored output
+// Set NO_COLOR to disable colors.
+func ColorEnabled() bool {
+	return isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+}
 
-		// Remove from remaining
-		newRemaining := []string{}
-		for _, item := range remaining {
-			if item != choice {
-				newRemaining = append(newRemaining, item)
-			}
-		}
-		remaining = newRemaining
+// isTerminal reports whether f is connected to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
-
-	return selected, nil
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 // GetWorktreeRoot returns the root directory for worktrees and the repository name
@@ -293,16 +201,64 @@ func getRepositoryName() (string, error) {
 
 	// Parse first worktree path
 	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
+	for i, line := range lines {
 		if strings.HasPrefix(line, "worktree ") {
 			mainPath := strings.TrimPrefix(line, "worktree ")
-			return filepath.Base(mainPath), nil
+			name := filepath.Base(mainPath)
+			// Bare repositories are usually named repo.git or hidden in repo/.bare
+			if i+1 < len(lines) && lines[i+1] == "bare" {
+				name = strings.TrimSuffix(name, ".git")
+				if name == "" || strings.HasPrefix(name, ".") {
+					name = filepath.Base(filepath.Dir(mainPath))
+				}
+			}
+			return name, nil
 		}
 	}
 
 	return "", fmt.Errorf("failed to determine repository name")
 }
 
+// Choice is an option offered by Choose
+type Choice struct {
+	Key   string // what the user types to pick this choice
+	Label string
+}
+
+// Choose asks the user to pick one of choices and returns the key of the picked choice
+// The prompt is shown on stderr and read from the terminal so that stdin and stdout
+// stay available to scripts. An empty answer returns ErrCancelled.
+func Choose(message string, choices []Choice) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to open TTY: %w", err)
+	}
+	defer tty.Close()
+
+	labels := make([]string, len(choices))
+	for i, c := range choices {
+		labels[i] = fmt.Sprintf("[%s]%s", c.Key, strings.TrimPrefix(c.Label, c.Key))
+	}
+
+	reader := bufio.NewReader(tty)
+	for {
+		fmt.Fprintf(os.Stderr, "%s\n%s: ", message, strings.Join(labels, " / "))
+		line, err := reader.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "" {
+			if err != nil && err != io.EOF {
+				return "", fmt.Errorf("failed to read answer: %w", err)
+			}
+			return "", ErrCancelled
+		}
+		for _, c := range choices {
+			if answer == c.Key || answer == strings.ToLower(c.Label) {
+				return c.Key, nil
+			}
+		}
+	}
+}
+
 // Confirm asks for user confirmation
 func Confirm(message string) (bool, error) {
 	fmt.Printf("%s [y/N]: ", message)
@@ -316,3 +272,16 @@ func Confirm(message string) (bool, error) {
 	response = strings.ToLower(strings.TrimSpace(response))
 	return response == "y" || response == "yes", nil
 }
+
+// ConfirmTyped asks the user to type word to confirm a destructive action
+func ConfirmTyped(message, word string) (bool, error) {
+	fmt.Printf("%s Type %q to confirm: ", message, word)
+
+	var response string
+	_, err := fmt.Scanln(&response)
+	if err != nil {
+		return false, nil
+	}
+
+	return strings.TrimSpace(response) == word, nil
+}
@@ -0,0 +1,332 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/qawatake/gw/internal/shell"
+)
+
+// SelectOptions configure a selection
+type SelectOptions struct {
+	Prompt string
+	// Query pre-fills the filter
+	Query string
+	// Preview is a shell command showing details of the highlighted item,
+	// with "{}" replaced by the item. Backends that don't support previews ignore it.
+	Preview string
+}
+
+// Selector is an interactive selection backend
+// Select and MultiSelect return ErrCancelled if the user cancels the selection.
+type Selector interface {
+	// Select returns the item the user picked
+	Select(items []string, opts SelectOptions) (string, error)
+	// MultiSelect returns the items the user picked, in any number
+	MultiSelect(items []string, opts SelectOptions) ([]string, error)
+}
+
+// Select picks an item with the configured selector
+func Select(items []string, opts SelectOptions) (string, error) {
+	selector, err := NewSelector()
+	if err != nil {
+		return "", err
+	}
+	return selector.Select(items, opts)
+}
+
+// MultiSelect picks any number of items with the configured selector
+func MultiSelect(items []string, opts SelectOptions) ([]string, error) {
+	selector, err := NewSelector()
+	if err != nil {
+		return nil, err
+	}
+	return selector.MultiSelect(items, opts)
+}
+
+// NewSelector returns the selector configured by GW_SELECTOR
+// GW_SELECTOR is one of peco, fzf, sk and builtin, or a command template
+// (see commandSelector). If it's not set, the first installed of peco, fzf
+// and sk is used for single selection and of fzf, sk and peco for multiple
+// selection, falling back to the built-in selector.
+func NewSelector() (Selector, error) {
+	name := strings.TrimSpace(os.Getenv("GW_SELECTOR"))
+	switch name {
+	case "":
+		return autoSelector{}, nil
+	case "builtin":
+		return builtinSelector{}, nil
+	}
+
+	if finder, ok := finders[name]; ok {
+		if !installed(finder.name) {
+			return nil, fmt.Errorf("selector %s not found (GW_SELECTOR=%s)", finder.name, name)
+		}
+		return finder, nil
+	}
+	return commandSelector{template: name}, nil
+}
+
+// finder runs an external fuzzy finder that reads items on stdin and prints
+// the selected ones on stdout
+type finder struct {
+	name string
+	// args returns the command line arguments for a selection
+	args func(opts SelectOptions, multi bool) []string
+	// cancelCodes are the exit codes meaning the selection was cancelled
+	cancelCodes []int
+	// multi reports whether the finder can select several items at once;
+	// otherwise it's asked repeatedly
+	multi bool
+}
+
+// fzfArgs are the arguments of fzf and of skim, which mimics fzf
+func fzfArgs(opts SelectOptions, multi bool) []string {
+	var args []string
+	if multi {
+		args = append(args, "--multi")
+	}
+	if opts.Prompt != "" {
+		args = append(args, "--prompt="+opts.Prompt)
+	}
+	if opts.Query != "" {
+		args = append(args, "--query="+opts.Query)
+	}
+	if opts.Preview != "" {
+		args = append(args, "--preview="+opts.Preview)
+	}
+	return args
+}
+
+var finders = map[string]finder{
+	"peco": {
+		name: "peco",
+		args: func(opts SelectOptions, multi bool) []string {
+			args := []string{"--on-cancel=error"}
+			if opts.Prompt != "" {
+				args = append(args, "--prompt", opts.Prompt)
+			}
+			if opts.Query != "" {
+				args = append(args, "--query", opts.Query)
+			}
+			return args
+		},
+		// exit code 1 = cancelled (--on-cancel=error)
+		cancelCodes: []int{1},
+	},
+	"fzf": {
+		name: "fzf",
+		args: fzfArgs,
+		// exit code 1 = no match, exit code 130 = ESC or Ctrl+C
+		cancelCodes: []int{1, 130},
+		multi:       true,
+	},
+	"sk": {
+		name:        "sk",
+		args:        fzfArgs,
+		cancelCodes: []int{1, 130},
+		multi:       true,
+	},
+}
+
+func (f finder) Select(items []string, opts SelectOptions) (string, error) {
+	selected, err := runFinder(exec.Command(f.name, f.args(opts, false)...), items, f.cancelCodes)
+	if err != nil {
+		return "", err
+	}
+	if len(selected) == 0 {
+		return "", ErrCancelled
+	}
+	return selected[0], nil
+}
+
+func (f finder) MultiSelect(items []string, opts SelectOptions) ([]string, error) {
+	if !f.multi {
+		return multiSelectRepeated(f, items, opts)
+	}
+	if opts.Prompt == "" {
+		opts.Prompt = "Select (Tab to select, Enter to confirm): "
+	}
+	return runFinder(exec.Command(f.name, f.args(opts, true)...), items, f.cancelCodes)
+}
+
+// commandSelector runs a command template from GW_SELECTOR with sh
+// The command reads items on stdin and prints the selected ones on stdout;
+// exit code 1 or 130 means the selection was cancelled. These placeholders
+// are replaced with shell-quoted values:
+//   - {prompt}: the prompt
+//   - {query}: the initial query
+//   - {preview}: the preview command
+//
+// The same command is used for single and multiple selection.
+type commandSelector struct {
+	template string
+}
+
+func (c commandSelector) command(opts SelectOptions) *exec.Cmd {
+	command := strings.NewReplacer(
+		"{prompt}", shell.Quote(opts.Prompt),
+		"{query}", shell.Quote(opts.Query),
+		"{preview}", shell.Quote(opts.Preview),
+	).Replace(c.template)
+	return exec.Command("sh", "-c", command)
+}
+
+func (c commandSelector) Select(items []string, opts SelectOptions) (string, error) {
+	selected, err := runFinder(c.command(opts), items, []int{1, 130})
+	if err != nil {
+		return "", err
+	}
+	if len(selected) == 0 {
+		return "", ErrCancelled
+	}
+	return selected[0], nil
+}
+
+func (c commandSelector) MultiSelect(items []string, opts SelectOptions) ([]string, error) {
+	return runFinder(c.command(opts), items, []int{1, 130})
+}
+
+// autoSelector uses whichever finder is installed
+type autoSelector struct{}
+
+func (autoSelector) single() Selector {
+	for _, name := range []string{"peco", "fzf", "sk"} {
+		if installed(name) {
+			return finders[name]
+		}
+	}
+	return builtinSelector{}
+}
+
+func (autoSelector) multi() Selector {
+	for _, name := range []string{"fzf", "sk", "peco"} {
+		if installed(name) {
+			return finders[name]
+		}
+	}
+	return builtinSelector{}
+}
+
+func (a autoSelector) Select(items []string, opts SelectOptions) (string, error) {
+	return a.single().Select(items, opts)
+}
+
+func (a autoSelector) MultiSelect(items []string, opts SelectOptions) ([]string, error) {
+	return a.multi().MultiSelect(items, opts)
+}
+
+// installed reports whether a command is found in PATH
+func installed(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// runFinder runs a finder with items on its stdin and returns the lines it prints
+func runFinder(cmd *exec.Cmd, items []string, cancelCodes []int) ([]string, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items to select")
+	}
+
+	// Connect to TTY for interactive mode
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TTY: %w", err)
+	}
+	defer tty.Close()
+
+	// Set up pipes before starting
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	// Finders display UI on stderr and read keyboard input from TTY
+	cmd.Stderr = tty
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cmd.Args[0], err)
+	}
+
+	// Write items to stdin
+	go func() {
+		defer stdin.Close()
+		for _, item := range items {
+			fmt.Fprintln(stdin, item)
+		}
+	}()
+
+	// Read stdout
+	output, err := io.ReadAll(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output: %w", err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && slices.Contains(cancelCodes, exitErr.ExitCode()) {
+			return nil, ErrCancelled
+		}
+		return nil, fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+
+	// Parse selected items
+	result := strings.TrimRight(string(output), "\n")
+	if result == "" {
+		return []string{}, nil
+	}
+	return strings.Split(result, "\n"), nil
+}
+
+// multiSelectRepeated selects one item at a time until "Done" is chosen
+// The query only filters the first selection so that "Done" can be found afterwards.
+func multiSelectRepeated(s Selector, items []string, opts SelectOptions) ([]string, error) {
+	const doneMarker = "*** Done - Finish selection ***"
+	var selected []string
+	remaining := make([]string, len(items))
+	copy(remaining, items)
+
+	for {
+		if len(remaining) == 0 {
+			break
+		}
+
+		// Add "Done" option to the list
+		choices := make([]string, 0, len(remaining)+1)
+		choices = append(choices, doneMarker)
+		choices = append(choices, remaining...)
+
+		choice, err := s.Select(choices, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Query = ""
+
+		// Check if user selected "Done"
+		if choice == doneMarker {
+			break
+		}
+
+		// Add to selected
+		selected = append(selected, choice)
+
+		// Remove from remaining
+		newRemaining := []string{}
+		for _, item := range remaining {
+			if item != choice {
+				newRemaining = append(newRemaining, item)
+			}
+		}
+		remaining = newRemaining
+	}
+
+	return selected, nil
+}
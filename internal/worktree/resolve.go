@@ -0,0 +1,47 @@
+package worktree
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Resolve returns the worktrees that query refers to
+// A worktree matches exactly if query is its branch, the last component of its
+// branch, its container dir name, a segment of its path under rootDir or its path.
+// If no worktree matches exactly, the worktrees whose branch or path contains
+// query (ignoring case) are returned.
+func Resolve(worktrees []Worktree, query, rootDir, repoName string) []Worktree {
+	var exact, partial []Worktree
+	lowerQuery := strings.ToLower(query)
+	for _, wt := range worktrees {
+		if slices.Contains(names(wt, rootDir, repoName), query) {
+			exact = append(exact, wt)
+			continue
+		}
+		if strings.Contains(strings.ToLower(wt.Branch), lowerQuery) ||
+			strings.Contains(strings.ToLower(displayPath(wt.Path)), lowerQuery) {
+			partial = append(partial, wt)
+		}
+	}
+
+	if len(exact) > 0 {
+		return exact
+	}
+	return partial
+}
+
+// names returns the names a worktree can be referred to by exactly
+func names(wt Worktree, rootDir, repoName string) []string {
+	names := []string{wt.Path, filepath.Base(wt.Path)}
+	if wt.Branch != "" && !wt.IsBare {
+		names = append(names, wt.Branch, wt.Branch[strings.LastIndex(wt.Branch, "/")+1:])
+	}
+	if dir := ContainerDir(wt.Path, rootDir, repoName); dir != "" {
+		names = append(names, filepath.Base(dir))
+	}
+	if rel, err := filepath.Rel(rootDir, wt.Path); err == nil && !strings.HasPrefix(rel, "..") {
+		names = append(names, strings.Split(rel, string(filepath.Separator))...)
+	}
+	return names
+}
@@ -0,0 +1,79 @@
+package worktree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortOrders are the orders accepted by Sort
+var SortOrders = []string{"activity", "created", "visited", "commit", "name", "frecency"}
+
+// Sort sorts worktrees in place
+//   - activity: most recent of creation, last visit and last commit first
+//   - created, visited, commit: most recent first
+//   - name: by branch name
+//   - frecency: most often and recently visited first, then by activity
+func Sort(worktrees []Worktree, order string) error {
+	now := time.Now()
+	var less func(a, b Worktree) bool
+	switch order {
+	case "activity":
+		less = func(a, b Worktree) bool { return LastActivity(a).After(LastActivity(b)) }
+	case "created":
+		less = func(a, b Worktree) bool { return a.Created.After(b.Created) }
+	case "visited":
+		less = func(a, b Worktree) bool { return a.Visited.After(b.Visited) }
+	case "commit":
+		less = func(a, b Worktree) bool { return a.Date.After(b.Date) }
+	case "name":
+		less = func(a, b Worktree) bool { return a.Branch < b.Branch }
+	case "frecency":
+		less = func(a, b Worktree) bool {
+			fa, fb := frecency(a, now), frecency(b, now)
+			if fa != fb {
+				return fa > fb
+			}
+			return LastActivity(a).After(LastActivity(b))
+		}
+	default:
+		return fmt.Errorf("invalid sort order %q (must be one of %s)", order, strings.Join(SortOrders, ", "))
+	}
+
+	sort.SliceStable(worktrees, func(i, j int) bool {
+		return less(worktrees[i], worktrees[j])
+	})
+	return nil
+}
+
+// LastActivity returns the most recent of a worktree's creation, last visit and last commit
+func LastActivity(wt Worktree) time.Time {
+	t := wt.Date
+	if wt.Created.After(t) {
+		t = wt.Created
+	}
+	if wt.Visited.After(t) {
+		t = wt.Visited
+	}
+	return t
+}
+
+// frecency scores a worktree by how often and how recently it was visited
+func frecency(wt Worktree, now time.Time) float64 {
+	if wt.Visits == 0 {
+		return 0
+	}
+
+	age := now.Sub(wt.Visited)
+	weight := 0.25
+	switch {
+	case age < time.Hour:
+		weight = 4
+	case age < 24*time.Hour:
+		weight = 2
+	case age < 7*24*time.Hour:
+		weight = 0.5
+	}
+	return float64(wt.Visits) * weight
+}
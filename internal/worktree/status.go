@@ -0,0 +1,338 @@
+package worktree
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Status describes the state of a worktree's working tree and branch
+type Status struct {
+	Dirty         int    `json:"dirty"`     // modified, staged or deleted files
+	Untracked     int    `json:"untracked"` // untracked files
+	HasUpstream   bool   `json:"has_upstream"`
+	Ahead         int    `json:"ahead"`  // commits ahead of upstream
+	Behind        int    `json:"behind"` // commits behind upstream
+	DefaultBranch string `json:"default_branch,omitempty"`
+	AheadDefault  int    `json:"ahead_default"`  // commits ahead of the default branch
+	BehindDefault int    `json:"behind_default"` // commits behind the default branch
+	Subject       string `json:"subject"`        // subject of the last commit
+}
+
+// maxParallel bounds the number of git processes run concurrently
+var maxParallel = min(runtime.NumCPU(), 8)
+
+// LoadStatus fills in the Status of each worktree
+// defaultBranch is the ref that AheadDefault/BehindDefault are counted against;
+// if it's empty those columns are left out.
+// Commit subjects and upstream tracking are read with one git call each;
+// only the per-worktree checks (working tree changes and ahead/behind the default
+// branch) run once per worktree, with bounded parallelism.
+func LoadStatus(worktrees []Worktree, defaultBranch string) {
+	commits, _ := getCommits(worktrees)
+	upstreams, _ := getUpstreams()
+
+	statuses := make([]Status, len(worktrees))
+	forEachParallel(len(worktrees), func(i int) {
+		wt := worktrees[i]
+		status := &statuses[i]
+		status.Subject = commits[wt.Commit].Subject
+		if u, ok := upstreams[wt.Branch]; ok {
+			status.HasUpstream = true
+			status.Ahead, status.Behind = u.ahead, u.behind
+		}
+
+		// The directory of a prunable worktree is gone
+		if !wt.Prunable {
+			status.Dirty, status.Untracked = countChanges(wt.Path)
+		}
+
+		if defaultBranch != "" && wt.Commit != "" {
+			if behind, ahead, err := countLeftRight(defaultBranch, wt.Commit); err == nil {
+				status.DefaultBranch = defaultBranch
+				status.AheadDefault, status.BehindDefault = ahead, behind
+			}
+		}
+	})
+
+	for i := range worktrees {
+		worktrees[i].Status = &statuses[i]
+	}
+}
+
+// forEachParallel calls fn for 0..n-1 with at most maxParallel calls running at once
+func forEachParallel(n int, fn func(i int)) {
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// countChanges returns the number of changed and untracked files in a worktree,
+// or zeros if they can't be read
+func countChanges(path string) (int, int) {
+	dirty, untracked, _ := readChanges(path)
+	return dirty, untracked
+}
+
+// readChanges returns the number of changed and untracked files in a worktree
+func readChanges(path string) (int, int, error) {
+	output, err := exec.Command("git", "-C", path, "status", "--porcelain").Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get status of %s: %w", path, err)
+	}
+
+	var dirty, untracked int
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "??"):
+			untracked++
+		default:
+			dirty++
+		}
+	}
+	return dirty, untracked, nil
+}
+
+// upstreamTrack is how far a local branch is from its upstream
+type upstreamTrack struct {
+	ahead  int
+	behind int
+}
+
+// getUpstreams returns the tracking state of every local branch that has an
+// upstream, keyed by branch name, using a single git invocation
+// Branches whose upstream is gone are left out.
+func getUpstreams() (map[string]upstreamTrack, error) {
+	upstreams := make(map[string]upstreamTrack)
+
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname)%00%(upstream)%00%(upstream:track,nobracket)", "refs/heads")
+	output, err := cmd.Output()
+	if err != nil {
+		return upstreams, fmt.Errorf("failed to get upstreams: %w", err)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 || fields[1] == "" || fields[2] == "gone" {
+			continue
+		}
+		var track upstreamTrack
+		// e.g. "ahead 1, behind 2", "ahead 1", "behind 2" or "" when in sync
+		for _, part := range strings.Split(fields[2], ", ") {
+			fmt.Sscanf(part, "ahead %d", &track.ahead)
+			fmt.Sscanf(part, "behind %d", &track.behind)
+		}
+		upstreams[strings.TrimPrefix(fields[0], "refs/heads/")] = track
+	}
+	return upstreams, nil
+}
+
+// countLeftRight returns the number of commits only in left and only in right
+func countLeftRight(left, right string) (int, int, error) {
+	output, err := exec.Command("git", "rev-list", "--left-right", "--count", left+"..."+right).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var l, r int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(output)), "%d %d", &l, &r); err != nil {
+		return 0, 0, err
+	}
+	return l, r, nil
+}
+
+// ANSI colors for status columns
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorDim    = "\033[2m"
+)
+
+// column is a table cell with an optional color
+type column struct {
+	text  string
+	color string
+}
+
+// FormatTable formats worktrees as aligned lines that fit in width
+// Columns: branch, changes, ahead/behind upstream, ahead/behind default branch,
+// last commit age, last commit subject, path. Status columns are only shown
+// for worktrees whose Status has been loaded. The path always comes last so
+// that it can be recovered from a line.
+func FormatTable(worktrees []Worktree, width int, color bool) []string {
+	rows := make([][]column, len(worktrees))
+	for i, wt := range worktrees {
+		rows[i] = tableRow(wt)
+	}
+
+	// Column widths; the subject (second to last) gets what's left
+	ncols := 0
+	for _, row := range rows {
+		ncols = max(ncols, len(row))
+	}
+	widths := make([]int, ncols)
+	for _, row := range rows {
+		for j, c := range row {
+			widths[j] = max(widths[j], utf8.RuneCountInString(c.text))
+		}
+	}
+	if ncols > 2 {
+		subject := ncols - 2
+		used := 0
+		for j, w := range widths {
+			if j != subject {
+				used += w + 2
+			}
+		}
+		widths[subject] = min(widths[subject], max(width-used, 0))
+	}
+
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		var b strings.Builder
+		for j, c := range row {
+			text := truncate(c.text, widths[j])
+			if j == len(row)-1 {
+				// Don't pad the last column to avoid trailing spaces
+				b.WriteString(text)
+				break
+			}
+			if widths[j] == 0 {
+				continue
+			}
+			pad := strings.Repeat(" ", widths[j]-utf8.RuneCountInString(text)+2)
+			if color && c.color != "" && text != "" {
+				text = c.color + text + colorReset
+			}
+			b.WriteString(text + pad)
+		}
+		lines[i] = b.String()
+	}
+	return lines
+}
+
+func tableRow(wt Worktree) []column {
+	path := displayPath(wt.Path)
+	if wt.Status == nil {
+		return []column{{text: Label(wt)}, {text: path}}
+	}
+	s := wt.Status
+
+	changes := column{text: "-"}
+	if s.Dirty > 0 || s.Untracked > 0 {
+		var parts []string
+		if s.Dirty > 0 {
+			parts = append(parts, fmt.Sprintf("~%d", s.Dirty))
+		}
+		if s.Untracked > 0 {
+			parts = append(parts, fmt.Sprintf("?%d", s.Untracked))
+		}
+		changes = column{text: strings.Join(parts, " "), color: colorYellow}
+	}
+
+	upstream := column{text: "-"}
+	if s.HasUpstream {
+		upstream = aheadBehind(s.Ahead, s.Behind)
+	}
+
+	vsDefault := column{text: "-"}
+	if s.DefaultBranch != "" {
+		vsDefault = aheadBehind(s.AheadDefault, s.BehindDefault)
+	}
+
+	age := column{text: "-"}
+	if !wt.Date.IsZero() {
+		age = column{text: RelativeTime(wt.Date), color: colorDim}
+	}
+
+	return []column{
+		{text: Label(wt)},
+		changes,
+		upstream,
+		vsDefault,
+		age,
+		{text: s.Subject},
+		{text: path},
+	}
+}
+
+func aheadBehind(ahead, behind int) column {
+	switch {
+	case ahead == 0 && behind == 0:
+		return column{text: "="}
+	case behind == 0:
+		return column{text: fmt.Sprintf("↑%d", ahead), color: colorGreen}
+	case ahead == 0:
+		return column{text: fmt.Sprintf("↓%d", behind), color: colorRed}
+	default:
+		return column{text: fmt.Sprintf("↑%d ↓%d", ahead, behind), color: colorYellow}
+	}
+}
+
+// truncate shortens s to at most width runes, marking the cut with "…"
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// RelativeTime formats the time elapsed since t compactly (e.g. "3d ago")
+func RelativeTime(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	case d < 60*24*time.Hour:
+		return fmt.Sprintf("%dw ago", int(d.Hours()/24/7))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(d.Hours()/24/30))
+	default:
+		return fmt.Sprintf("%dy ago", int(d.Hours()/24/365))
+	}
+}
+
+// ShortStatus returns the output of `git status --short` in a worktree
+func ShortStatus(path string) (string, error) {
+	output, err := exec.Command("git", "-C", path, "status", "--short").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get status: %w", err)
+	}
+	return string(output), nil
+}
+
+// RecentCommits returns one line per commit for the last n commits of a worktree
+func RecentCommits(path string, n int) (string, error) {
+	output, err := exec.Command("git", "-C", path, "log", "-n", strconv.Itoa(n), "--format=%h %s (%cr)").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get log: %w", err)
+	}
+	return string(output), nil
+}
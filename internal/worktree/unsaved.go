@@ -0,0 +1,118 @@
+package worktree
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Unsaved describes the work that removing a worktree and its branch would lose
+type Unsaved struct {
+	Dirty     int      // modified, staged or deleted files
+	Untracked int      // untracked files
+	Stashes   []string // stashes made on the worktree's branch
+	Commits   []string // commits not reachable from any remote or the default branch
+}
+
+// Empty reports whether nothing would be lost
+func (u Unsaved) Empty() bool {
+	return u.Dirty == 0 && u.Untracked == 0 && len(u.Stashes) == 0 && len(u.Commits) == 0
+}
+
+// Summary describes the unsaved work in one line per kind
+func (u Unsaved) Summary(defaultRef string) []string {
+	var lines []string
+	if u.Dirty > 0 {
+		lines = append(lines, plural(u.Dirty, "uncommitted change"))
+	}
+	if u.Untracked > 0 {
+		lines = append(lines, plural(u.Untracked, "untracked file"))
+	}
+	if len(u.Stashes) > 0 {
+		lines = append(lines, plural(len(u.Stashes), "stash"))
+	}
+	if len(u.Commits) > 0 {
+		where := "any remote"
+		if defaultRef != "" {
+			where += " or " + defaultRef
+		}
+		lines = append(lines, fmt.Sprintf("%s not on %s", plural(len(u.Commits), "commit"), where))
+	}
+	return lines
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	if strings.HasSuffix(noun, "sh") {
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// FindUnsaved returns the work in wt that would be lost by removing it and its branch
+// Commits count as saved once they are reachable from a remote-tracking branch or
+// from defaultRef, which must exist (skipped if empty). The working tree of a prunable worktree
+// is already gone, so only its commits and stashes are checked. An error means
+// the check is incomplete, not that nothing would be lost.
+func FindUnsaved(wt Worktree, defaultRef string) (Unsaved, error) {
+	var u Unsaved
+	if !wt.Prunable {
+		var err error
+		u.Dirty, u.Untracked, err = readChanges(wt.Path)
+		if err != nil {
+			return u, err
+		}
+	}
+
+	if !wt.Detached {
+		stashes, err := branchStashes(wt.Branch)
+		if err != nil {
+			return u, err
+		}
+		u.Stashes = stashes
+	}
+
+	if wt.Commit != "" {
+		args := []string{"log", "--format=%h %s", wt.Commit, "--not", "--remotes"}
+		if defaultRef != "" {
+			args = append(args, defaultRef)
+		}
+		output, err := exec.Command("git", append(args, "--")...).Output()
+		if err != nil {
+			return u, fmt.Errorf("failed to list unpushed commits: %w", err)
+		}
+		u.Commits = nonEmptyLines(string(output))
+	}
+	return u, nil
+}
+
+// branchStashes returns the stashes made on branchName
+// Stashes are shared by all worktrees; git records the branch in the message
+// as "WIP on <branch>: ..." or "On <branch>: ...".
+func branchStashes(branchName string) ([]string, error) {
+	output, err := exec.Command("git", "stash", "list", "--format=%gd %gs").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stashes: %w", err)
+	}
+
+	var stashes []string
+	for _, line := range nonEmptyLines(string(output)) {
+		_, subject, _ := strings.Cut(line, " ")
+		if strings.HasPrefix(subject, "WIP on "+branchName+": ") || strings.HasPrefix(subject, "On "+branchName+": ") {
+			stashes = append(stashes, line)
+		}
+	}
+	return stashes, nil
+}
+
+func nonEmptyLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -2,20 +2,36 @@ package worktree
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/qawatake/gw/internal/branch"
 )
 
 // Worktree represents a git worktree
 type Worktree struct {
-	Path   string
-	Branch string
-	Commit string
-	Date   time.Time
-	IsMain bool // true if this is the main worktree
+	Path           string    `json:"path"`
+	Branch         string    `json:"branch"`
+	Commit         string    `json:"commit"`
+	Date           time.Time `json:"date"`
+	IsMain         bool      `json:"is_main"` // true if this is the main worktree
+	IsBare         bool      `json:"is_bare"` // true if this is the bare repository (not a worktree)
+	Detached       bool      `json:"detached"`
+	Locked         bool      `json:"locked"`
+	LockedReason   string    `json:"locked_reason,omitempty"`
+	Prunable       bool      `json:"prunable"`
+	PrunableReason string    `json:"prunable_reason,omitempty"`
+	Created        time.Time `json:"created,omitzero"` // only set from the state store
+	Visited        time.Time `json:"visited,omitzero"` // only set from the state store
+	Visits         int       `json:"visits,omitempty"` // only set from the state store
+	Status         *Status   `json:"status,omitempty"` // only set by LoadStatus
 }
 
 // List returns all worktrees sorted by date (newest first)
@@ -32,17 +48,25 @@ func List() ([]Worktree, error) {
 		return nil, err
 	}
 
-	// Get commit dates for sorting
+	// Older versions of git don't report prunable worktrees
 	for i := range worktrees {
-		date, err := getCommitDate(worktrees[i].Commit)
-		if err != nil {
-			// If we can't get the date, use epoch time
-			worktrees[i].Date = time.Time{}
-		} else {
-			worktrees[i].Date = date
+		wt := &worktrees[i]
+		if wt.Prunable || wt.IsBare {
+			continue
+		}
+		if _, err := os.Stat(wt.Path); os.IsNotExist(err) {
+			wt.Prunable = true
+			wt.PrunableReason = "directory does not exist"
 		}
 	}
 
+	// Get commit dates for sorting in a single git call
+	// If we can't get the dates, epoch time is used
+	commits, _ := getCommits(worktrees)
+	for i := range worktrees {
+		worktrees[i].Date = commits[worktrees[i].Commit].Date
+	}
+
 	// Sort by date (newest first)
 	sort.Slice(worktrees, func(i, j int) bool {
 		return worktrees[i].Date.After(worktrees[j].Date)
@@ -51,33 +75,51 @@ func List() ([]Worktree, error) {
 	return worktrees, nil
 }
 
+// Main returns the main worktree from a worktree list, or nil for a bare repository
+func Main(worktrees []Worktree) *Worktree {
+	for i := range worktrees {
+		if worktrees[i].IsMain {
+			return &worktrees[i]
+		}
+	}
+	return nil
+}
+
+// MainPath returns the path of the main worktree
+// For a bare repository it returns the path of the repository.
+func MainPath() (string, error) {
+	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	worktrees, err := parseWorktreeList(string(output))
+	if err != nil {
+		return "", err
+	}
+	if len(worktrees) == 0 {
+		return "", fmt.Errorf("main worktree not found")
+	}
+	return worktrees[0].Path, nil
+}
+
 func parseWorktreeList(output string) ([]Worktree, error) {
 	var worktrees []Worktree
 	var current Worktree
-	isFirst := true
 
 	lines := strings.Split(strings.TrimSpace(output), "\n")
 	for _, line := range lines {
 		if line == "" {
 			if current.Path != "" {
-				// First worktree is the main worktree
-				if isFirst {
-					current.IsMain = true
-					isFirst = false
-				}
 				worktrees = append(worktrees, current)
 				current = Worktree{}
 			}
 			continue
 		}
 
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
-			continue
-		}
-
-		key := parts[0]
-		value := parts[1]
+		// Some keys (e.g. "bare", "detached", "locked") have no value
+		key, value, _ := strings.Cut(line, " ")
 
 		switch key {
 		case "worktree":
@@ -88,69 +130,152 @@ func parseWorktreeList(output string) ([]Worktree, error) {
 			// branch refs/heads/main -> main
 			current.Branch = strings.TrimPrefix(value, "refs/heads/")
 		case "detached":
-			current.Branch = fmt.Sprintf("(detached at %s)", value[:7])
+			current.Detached = true
+		case "bare":
+			current.IsBare = true
+		case "locked":
+			current.Locked = true
+			current.LockedReason = value
+		case "prunable":
+			current.Prunable = true
+			current.PrunableReason = value
 		}
 	}
 
 	// Add last worktree if exists
 	if current.Path != "" {
-		// First worktree is the main worktree
-		if isFirst {
-			current.IsMain = true
-		}
 		worktrees = append(worktrees, current)
 	}
 
+	// First worktree is the main worktree, unless the repository is bare
+	// (then the first entry is the bare repository itself)
+	if len(worktrees) > 0 && !worktrees[0].IsBare {
+		worktrees[0].IsMain = true
+	}
+
 	return worktrees, nil
 }
 
-func getCommitDate(commit string) (time.Time, error) {
-	cmd := exec.Command("git", "show", "-s", "--format=%ct", commit)
-	output, err := cmd.Output()
-	if err != nil {
-		return time.Time{}, err
+// shortCommit abbreviates a commit hash to 7 characters
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
 	}
+	return commit
+}
 
-	timestamp := strings.TrimSpace(string(output))
-	var unixTime int64
-	_, err = fmt.Sscanf(timestamp, "%d", &unixTime)
+// commitInfo holds the details of a commit needed for listing
+type commitInfo struct {
+	Date    time.Time
+	Subject string
+}
+
+// getCommits returns the date and subject of the HEAD commit of each worktree
+// using a single git invocation regardless of the number of worktrees
+func getCommits(worktrees []Worktree) (map[string]commitInfo, error) {
+	commits := make(map[string]commitInfo)
+
+	var revs strings.Builder
+	for _, wt := range worktrees {
+		if wt.Commit != "" {
+			revs.WriteString(wt.Commit + "\n")
+		}
+	}
+	if revs.Len() == 0 {
+		return commits, nil
+	}
+
+	cmd := exec.Command("git", "log", "--no-walk=unsorted", "--stdin", "--format=%H%x00%ct%x00%s")
+	cmd.Stdin = strings.NewReader(revs.String())
+	output, err := cmd.Output()
 	if err != nil {
-		return time.Time{}, err
+		return commits, fmt.Errorf("failed to get commits: %w", err)
 	}
 
-	return time.Unix(unixTime, 0), nil
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		unixTime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		commits[fields[0]] = commitInfo{Date: time.Unix(unixTime, 0), Subject: fields[2]}
+	}
+	return commits, nil
 }
 
 // Format formats a worktree for display
 func Format(wt Worktree) string {
-	path := wt.Path
+	return fmt.Sprintf("%-40s %s", Label(wt), displayPath(wt.Path))
+}
+
+// Label returns the branch of a worktree annotated with its bare, locked and prunable state
+// Detached worktrees have no branch and are labeled with their commit instead.
+func Label(wt Worktree) string {
+	label := wt.Branch
+	switch {
+	case wt.IsBare:
+		label = "(bare)"
+	case wt.Detached:
+		label = fmt.Sprintf("(detached at %s)", shortCommit(wt.Commit))
+	}
+	if wt.Locked {
+		label += " [locked]"
+	}
+	if wt.Prunable {
+		label += " [prunable]"
+	}
+	return label
+}
+
+// displayPath abbreviates the home directory in path as ~
+func displayPath(path string) string {
 	// Try to make path relative to home directory
 	if home, err := getHomeDir(); err == nil {
 		if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
-			path = "~/" + rel
+			return "~/" + rel
 		}
 	}
-
-	return fmt.Sprintf("%-40s %s", wt.Branch, path)
+	return path
 }
 
-func getHomeDir() (string, error) {
-	cmd := exec.Command("sh", "-c", "echo $HOME")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", err
+// FormatPorcelain formats a worktree as a stable, tab-separated line for scripts
+// Format: {path}\t{branch}\t{commit}\t{unix time}\t{flags}
+// where branch is empty for detached worktrees and flags is a comma-separated
+// list of main, bare, detached, locked and prunable, or "-".
+func FormatPorcelain(wt Worktree) string {
+	var flags []string
+	if wt.IsMain {
+		flags = append(flags, "main")
+	}
+	if wt.IsBare {
+		flags = append(flags, "bare")
+	}
+	if wt.Detached {
+		flags = append(flags, "detached")
+	}
+	if wt.Locked {
+		flags = append(flags, "locked")
+	}
+	if wt.Prunable {
+		flags = append(flags, "prunable")
+	}
+	flagStr := "-"
+	if len(flags) > 0 {
+		flagStr = strings.Join(flags, ",")
 	}
-	return strings.TrimSpace(string(output)), nil
-}
 
-// Add creates a new worktree with a new branch
-func Add(path, branch string) error {
-	cmd := exec.Command("git", "worktree", "add", "-b", branch, path)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to add worktree: %w\n%s", err, string(output))
+	var unixTime int64
+	if !wt.Date.IsZero() {
+		unixTime = wt.Date.Unix()
 	}
-	return nil
+	return strings.Join([]string{wt.Path, wt.Branch, wt.Commit, strconv.FormatInt(unixTime, 10), flagStr}, "\t")
+}
+
+func getHomeDir() (string, error) {
+	return os.UserHomeDir()
 }
 
 // AddExistingBranch creates a worktree for an existing branch
@@ -163,23 +288,188 @@ func AddExistingBranch(path, branch string) error {
 	return nil
 }
 
+// DefaultPathTemplate is the worktree path layout used when GW_PATH_TEMPLATE is not set
+// It keeps a per-worktree container directory next to the worktree for notes etc.
+const DefaultPathTemplate = "{root}/{date}-{name}/{repo}"
+
+var pathPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// pathPlaceholders are the placeholders available in a path template
+var pathPlaceholders = []string{"{root}", "{date}", "{name}", "{branch}", "{repo}", "{user}"}
+
+// GetPathTemplate returns the worktree path template from GW_PATH_TEMPLATE
+func GetPathTemplate() (string, error) {
+	tmpl := os.Getenv("GW_PATH_TEMPLATE")
+	if tmpl == "" {
+		return DefaultPathTemplate, nil
+	}
+	if err := ValidatePathTemplate(tmpl); err != nil {
+		return "", fmt.Errorf("invalid GW_PATH_TEMPLATE: %w", err)
+	}
+	return tmpl, nil
+}
+
+// ValidatePathTemplate checks that a path template only uses known placeholders
+// and yields a distinct path per worktree
+func ValidatePathTemplate(tmpl string) error {
+	for _, p := range pathPlaceholder.FindAllString(tmpl, -1) {
+		if !slices.Contains(pathPlaceholders, p) {
+			return fmt.Errorf("unknown placeholder %s (available: %s)", p, strings.Join(pathPlaceholders, ", "))
+		}
+	}
+	if strings.ContainsAny(pathPlaceholder.ReplaceAllString(tmpl, ""), "{}") {
+		return fmt.Errorf("unbalanced braces in %q", tmpl)
+	}
+	if !strings.Contains(tmpl, "{name}") && !strings.Contains(tmpl, "{branch}") {
+		return fmt.Errorf("template must contain {name} or {branch}: %q", tmpl)
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(tmpl), "/") {
+		if segment == ".." {
+			return fmt.Errorf("template must not contain '..': %q", tmpl)
+		}
+	}
+	return nil
+}
+
 // GenerateWorktreePath generates a filesystem-safe path from user input name
-// Format: {rootDir}/{YYYY-MM-DD-name}/{repoName}
-func GenerateWorktreePath(name, rootDir, repoName string) string {
-	// Add date prefix
-	now := time.Now()
-	datePrefix := now.Format("2006-01-02")
+// and branch name using the path template (see GetPathTemplate)
+// Relative templates are resolved against rootDir.
+// Default format: {rootDir}/{YYYY-MM-DD-name}/{repoName}
+func GenerateWorktreePath(name, branchName, rootDir, repoName string) (string, error) {
+	tmpl, err := GetPathTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	values := map[string]string{
+		"{root}":   rootDir,
+		"{date}":   time.Now().Format("2006-01-02"),
+		"{name}":   sanitizePathComponent(name),
+		"{branch}": sanitizePathComponent(branchName),
+		"{repo}":   repoName,
+	}
+	if strings.Contains(tmpl, "{user}") {
+		userName, err := branch.GetGitUserName()
+		if err != nil {
+			return "", err
+		}
+		values["{user}"] = sanitizePathComponent(strings.ToLower(userName))
+	}
+
+	path := pathPlaceholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		return values[p]
+	})
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, path)
+	}
+	return filepath.Clean(path), nil
+}
 
+// sanitizePathComponent makes a name usable as a single path component
+func sanitizePathComponent(name string) string {
 	// Replace slashes with hyphens for filesystem safety
 	safeName := strings.ReplaceAll(name, "/", "-")
 	// Replace spaces with hyphens
 	safeName = strings.ReplaceAll(safeName, " ", "-")
+	return safeName
+}
+
+const notesFileName = "NOTES.md"
 
-	dirName := datePrefix + "-" + safeName
-	return filepath.Join(rootDir, dirName, repoName)
+// ContainerDir returns the per-worktree directory that holds a worktree created by gw,
+// or an empty string if the layout has none
+// With the default layout {root}/{date}-{name}/{repo} it is {root}/{date}-{name}.
+func ContainerDir(wtPath, rootDir, repoName string) string {
+	if filepath.Base(wtPath) != repoName {
+		return ""
+	}
+	dir := filepath.Dir(wtPath)
+	if rel, err := filepath.Rel(rootDir, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return dir
+}
+
+// NotesPath returns the notes file of a worktree created by gw
+// Format: {container}/NOTES.md, or {worktree}.notes.md if the layout has no container dir.
+// It returns an empty string for worktrees outside rootDir (e.g. the main worktree).
+func NotesPath(wtPath, rootDir, repoName string) string {
+	if dir := ContainerDir(wtPath, rootDir, repoName); dir != "" {
+		return filepath.Join(dir, notesFileName)
+	}
+	if rel, err := filepath.Rel(rootDir, wtPath); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return wtPath + ".notes.md"
+}
+
+// RemoveContainer removes what gw left next to a worktree whose directory is gone:
+// the container dir (with its notes file), or the notes file if the layout has no container
+// A container holding anything else is kept, and RemoveContainer reports false.
+func RemoveContainer(wtPath, rootDir, repoName string) (bool, error) {
+	container := ContainerDir(wtPath, rootDir, repoName)
+	if container == "" {
+		notesPath := NotesPath(wtPath, rootDir, repoName)
+		if notesPath == "" {
+			return false, nil
+		}
+		if err := os.Remove(notesPath); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to remove notes: %w", err)
+		}
+		return true, nil
+	}
+
+	entries, err := os.ReadDir(container)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", container, err)
+	}
+	for _, e := range entries {
+		if e.Name() != notesFileName && e.Name() != repoName {
+			return false, nil
+		}
+	}
+
+	if err := os.RemoveAll(container); err != nil {
+		return false, fmt.Errorf("failed to remove %s: %w", container, err)
+	}
+	return true, nil
+}
+
+// CurrentPath returns the top-level directory of the worktree containing the current directory
+func CurrentPath() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current worktree: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Prune removes the administrative files of worktrees whose directories are gone
+func Prune() error {
+	cmd := exec.Command("git", "worktree", "prune")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w\n%s", err, string(output))
+	}
+	return nil
+}
+
+// Unlock unlocks a locked worktree so that it can be removed
+func Unlock(path string) error {
+	cmd := exec.Command("git", "worktree", "unlock", path)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to unlock worktree: %w\n%s", err, string(output))
+	}
+	return nil
 }
 
 // Remove removes a worktree
+// Uncommitted changes are discarded, so check FindUnsaved first.
 func Remove(path string) error {
 	// Use --force to handle worktrees with submodules
 	cmd := exec.Command("git", "worktree", "remove", "--force", path)
@@ -191,6 +481,7 @@ func Remove(path string) error {
 }
 
 // RemoveBranch removes a git branch
+// Unmerged commits are discarded, so check FindUnsaved first.
 func RemoveBranch(branchName string) error {
 	// Use -D to force delete (removes even if not merged)
 	cmd := exec.Command("git", "branch", "-D", branchName)
@@ -0,0 +1,75 @@
+package worktree
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// worktreeCounts are the repository sizes the benchmarks compare
+// List runs a fixed number of git commands, so its latency shouldn't grow with them.
+var worktreeCounts = []int{1, 10, 40}
+
+// setupRepo creates a repository with n worktrees (besides the main one),
+// each on its own branch with its own commit, and changes into it
+func setupRepo(b *testing.B, n int) {
+	b.Helper()
+	dir := b.TempDir()
+	repo := filepath.Join(dir, "repo")
+
+	git := func(args ...string) {
+		b.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(cmd.Environ(),
+			"GIT_AUTHOR_NAME=gw", "GIT_AUTHOR_EMAIL=gw@localhost",
+			"GIT_COMMITTER_NAME=gw", "GIT_COMMITTER_EMAIL=gw@localhost",
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			b.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+
+	git("init", "-q", "-b", "main", repo)
+	git("-C", repo, "commit", "-q", "--allow-empty", "-m", "init")
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("wt%d", i))
+		git("-C", repo, "worktree", "add", "-q", "-b", fmt.Sprintf("branch%d", i), path)
+		git("-C", path, "commit", "-q", "--allow-empty", "-m", fmt.Sprintf("commit %d", i))
+	}
+
+	b.Chdir(repo)
+}
+
+func BenchmarkList(b *testing.B) {
+	for _, n := range worktreeCounts {
+		b.Run(fmt.Sprintf("worktrees=%d", n), func(b *testing.B) {
+			setupRepo(b, n)
+			for b.Loop() {
+				worktrees, err := List()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(worktrees) != n+1 {
+					b.Fatalf("got %d worktrees, want %d", len(worktrees), n+1)
+				}
+			}
+		})
+	}
+}
+
+// LoadStatus checks each working tree, with bounded parallelism
+func BenchmarkLoadStatus(b *testing.B) {
+	for _, n := range worktreeCounts {
+		b.Run(fmt.Sprintf("worktrees=%d", n), func(b *testing.B) {
+			setupRepo(b, n)
+			worktrees, err := List()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for b.Loop() {
+				LoadStatus(worktrees, "main")
+			}
+		})
+	}
+}